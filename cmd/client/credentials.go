@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passEnv - Environment variable read by the env credential source
+const passEnv = "WEBSOCKETLAB_PASS"
+
+// readPass - Returns the password for handle on server from the provided source
+func readPass(source string, server string, handle string) (string, error) {
+	switch source {
+	case "none", "":
+		return "", nil
+	case "env":
+		pass, ok := os.LookupEnv(passEnv)
+		if !ok {
+			return "", errors.New(passEnv + " is not set")
+		}
+		return pass, nil
+	case "prompt":
+		return promptPass(handle)
+	case "file":
+		return loadStoredPass(server, handle)
+	default:
+		return "", errors.New("Unknown credential source " + source)
+	}
+}
+
+// promptPass - Ask the user for the password of handle without echoing it
+// Falls back to reading a line when stdin is not a terminal
+func promptPass(handle string) (string, error) {
+	fmt.Print("Password for " + handle + ": ")
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		pass, err := term.ReadPassword(fd)
+		fmt.Println()
+		return string(pass), err
+	}
+	line, err := stdin.ReadString('\n')
+	fmt.Println()
+	return strings.TrimSpace(line), err
+}
+
+// credentialsPath - Encrypted credentials file
+var credentialsPath = defaultConfigPath("credentials")
+
+// keyPath - Key used to encrypt the credentials file, readable only by the user
+var keyPath = defaultConfigPath("credentials.key")
+
+// credentialKeyLen - Bytes in the credentials key, selecting AES-256
+const credentialKeyLen = 32
+
+// readCredentialKey - Returns the existing credentials key
+// A key of the wrong size is an error rather than being replaced, since replacing it would lose every saved password
+func readCredentialKey() ([]byte, error) {
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != credentialKeyLen {
+		return nil, fmt.Errorf("Credentials key %s holds %d bytes instead of %d - Restore it, or remove it along with %s and use -save-credentials again", keyPath, len(key), credentialKeyLen, credentialsPath)
+	}
+	return key, nil
+}
+
+// credentialKey - Returns the credentials key, creating it if there is none yet
+func credentialKey() ([]byte, error) {
+	key, err := readCredentialKey()
+	if !os.IsNotExist(err) {
+		return key, err
+	}
+	key = make([]byte, credentialKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, err
+	}
+	// Never overwrite a key created since it was read
+	file, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(key); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return key, file.Close()
+}
+
+// readStoredCredentials - Returns the encrypted entries of the credentials file keyed by handle@server
+func readStoredCredentials() (map[string]string, error) {
+	entries := make(map[string]string)
+	contents, err := ioutil.ReadFile(credentialsPath)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, json.Unmarshal(contents, &entries)
+}
+
+// loadStoredPass - Returns the saved password for handle on server
+func loadStoredPass(server string, handle string) (string, error) {
+	entries, err := readStoredCredentials()
+	if err != nil {
+		return "", err
+	}
+	sealed, ok := entries[handle+"@"+server]
+	if !ok {
+		return "", errors.New("No saved password for " + handle + " on " + server)
+	}
+	key, err := readCredentialKey()
+	if os.IsNotExist(err) {
+		return "", errors.New("Credentials key " + keyPath + " is missing - Unable to decrypt saved password")
+	}
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("Saved password is corrupt")
+	}
+	pass, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(handle+"@"+server))
+	if err != nil {
+		return "", errors.New("Unable to decrypt saved password")
+	}
+	return string(pass), nil
+}
+
+// storePass - Save the password for handle on server to the encrypted credentials file
+func storePass(server string, handle string, pass string) error {
+	key, err := credentialKey()
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(pass), []byte(handle+"@"+server))
+	entries, err := readStoredCredentials()
+	if err != nil {
+		return err
+	}
+	entries[handle+"@"+server] = base64.StdEncoding.EncodeToString(sealed)
+	contents, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(credentialsPath, contents, 0600)
+}
+
+// newGCM - Create an AES-GCM cipher using key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
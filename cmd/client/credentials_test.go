@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useCredentialFiles - Point the credentials and key paths at a temporary directory for the test
+func useCredentialFiles(t *testing.T) {
+	dir := t.TempDir()
+	savedCredentials, savedKey := credentialsPath, keyPath
+	credentialsPath = filepath.Join(dir, "credentials")
+	keyPath = filepath.Join(dir, "credentials.key")
+	t.Cleanup(func() { credentialsPath, keyPath = savedCredentials, savedKey })
+}
+
+func TestStoreAndLoadPass(t *testing.T) {
+	useCredentialFiles(t)
+	if err := storePass("ws://localhost:8080/", "Beth", "Beth33"); err != nil {
+		t.Fatalf("storePass returned error: %v", err)
+	}
+	pass, err := loadStoredPass("ws://localhost:8080/", "Beth")
+	if err != nil || pass != "Beth33" {
+		t.Errorf("loadStoredPass = %q, %v; want Beth33", pass, err)
+	}
+}
+
+func TestLoadPassDoesNotCreateKey(t *testing.T) {
+	useCredentialFiles(t)
+	if err := ioutil.WriteFile(credentialsPath, []byte(`{"Beth@ws://localhost:8080/": "c2VhbGVk"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStoredPass("ws://localhost:8080/", "Beth"); err == nil {
+		t.Error("loadStoredPass succeeded without a key")
+	}
+	if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+		t.Errorf("loadStoredPass created %s", keyPath)
+	}
+}
+
+func TestWrongSizeKeyIsKept(t *testing.T) {
+	useCredentialFiles(t)
+	short := []byte("too short")
+	if err := ioutil.WriteFile(keyPath, short, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(credentialsPath, []byte(`{"Beth@ws://localhost:8080/": "c2VhbGVk"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := storePass("ws://localhost:8080/", "Beth", "Beth33"); err == nil {
+		t.Error("storePass succeeded with a key of the wrong size")
+	}
+	if _, err := loadStoredPass("ws://localhost:8080/", "Beth"); err == nil {
+		t.Error("loadStoredPass succeeded with a key of the wrong size")
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil || !bytes.Equal(key, short) {
+		t.Errorf("key file was replaced with %d bytes", len(key))
+	}
+}
@@ -2,126 +2,397 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"os"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/masonflint44/websocketLab/pkg/helpers"
-	"github.com/masonflint44/websocketLab/pkg/interfaces"
-	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
 )
 
 var dialer = websocket.Dialer{}
-var inboundMessages = make(chan interfaces.Message)
-var outboundMessages = make(chan interfaces.Message)
+var stdin = bufio.NewReader(os.Stdin)
+var inboundMessages = make(chan protocol.Envelope)
+var outboundMessages = make(chan protocol.Envelope, 64)
+var quit = make(chan struct{})
+var session = &sessionState{}
+
+// unsent - Frame that failed to send and is retried after reconnecting
+var unsent *protocol.Envelope
 
 func main() {
+	flag.Parse()
 	fmt.Println("Client: Starting...")
 
-	conn, _, err := dialer.Dial("ws://localhost:11631", nil)
+	conf, err := resolveSettings()
 	if err != nil {
-		fmt.Println("Error: Unable to connect to server")
+		fmt.Println("Error: Unable to load profile -", err)
 		return
 	}
-	defer closeConn(conn)
+	if strings.HasPrefix(conf.Server, "wss://") {
+		tlsConf, err := clientTLSConfig(conf.CA, conf.ServerName, conf.Insecure)
+		if err != nil {
+			fmt.Println("Error: Unable to configure TLS -", err)
+			return
+		}
+		dialer.TLSClientConfig = tlsConf
+	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+	// Ask for the password before connecting so the prompt is not interleaved with server output
+	if conf.Handle != "" {
+		pass, err := readPass(conf.Credentials, conf.Server, conf.Handle)
+		if err != nil {
+			fmt.Println("Error: Unable to read password -", err)
+		} else if *saveCredentials && conf.Credentials == "prompt" {
+			if err := storePass(conf.Server, conf.Handle, pass); err != nil {
+				fmt.Println("Error: Unable to save password -", err)
+			}
+		}
+		if pass != "" {
+			login, err := protocol.NewEnvelope("login", protocol.CredentialsPayload{Handle: conf.Handle, Pass: pass})
+			if err == nil {
+				outboundMessages <- login
+			}
+		}
+	}
 
-	go receiveMessages(conn, &wg)
 	go printMessages()
-	go readInput(conn)
-	go sendMessages(conn)
+	go readInput()
 
-	wg.Wait()
+	attempt := 0
+	for {
+		conn, version, err := connect(conf.Server)
+		if err == nil {
+			if attempt > 0 {
+				fmt.Println("Client: Reconnected")
+			}
+			attempt = 0
+			if !serve(conn, version) {
+				return
+			}
+		} else {
+			fmt.Println("Error: Unable to connect to server -", err)
+		}
+		if !*reconnect {
+			return
+		}
+		delay := backoff(attempt, *minBackoff, *maxBackoff)
+		attempt++
+		fmt.Printf("Client: Reconnecting in %v...\n", delay.Round(time.Millisecond))
+		select {
+		case <-time.After(delay):
+		case <-quit:
+			return
+		}
+	}
+}
+
+// connect - Dial the server and negotiate the protocol version
+func connect(url string) (*websocket.Conn, int, error) {
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	version, err := handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, 0, fmt.Errorf("Unable to negotiate protocol version - %v", err)
+	}
+	return conn, version, nil
 }
 
-// sendMessages - Send queued messages to server
-func sendMessages(conn *websocket.Conn) {
+// serve - Exchange frames with the server until the connection is lost or the user quits
+// Returns true if the connection was lost
+func serve(conn *websocket.Conn, version int) bool {
+	defer closeConn(conn)
+
+	// Log back in and rejoin rooms before sending anything typed while disconnected
+	restore := session.restoreFrames()
+	if unsent != nil {
+		restore = append(restore, *unsent)
+	}
+	for _, frame := range restore {
+		if !sendFrame(conn, version, frame) {
+			return true
+		}
+	}
+	unsent = nil
+
+	received := make(chan struct{})
+	go receiveMessages(conn, received)
+
 	for {
-		message := <-outboundMessages
-		err := conn.WriteJSON(message)
-		if err != nil {
-			fmt.Println("Error: Unable to send message to server")
+		select {
+		case frame := <-outboundMessages:
+			if !sendFrame(conn, version, frame) {
+				unsent = &frame
+				return true
+			}
+			session.track(frame)
+		case <-received:
+			fmt.Println("Client: Disconnected")
+			return true
+		case <-quit:
+			// Input is closed; send whatever is still queued before leaving
+			for len(outboundMessages) > 0 {
+				sendFrame(conn, version, <-outboundMessages)
+			}
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return false
+		}
+	}
+}
+
+// sendFrame - Write frame to the server using the negotiated version
+func sendFrame(conn *websocket.Conn, version int, frame protocol.Envelope) bool {
+	frame.Version = version
+	if err := conn.WriteJSON(frame); err != nil {
+		fmt.Println("Error: Unable to send message to server")
+		return false
+	}
+	return true
+}
+
+// handshake - Offer the protocol versions this client speaks and return the one chosen by the server
+func handshake(conn *websocket.Conn) (int, error) {
+	hello, err := protocol.NewEnvelope(protocol.TypeHello, protocol.HelloPayload{Versions: protocol.SupportedVersions})
+	if err != nil {
+		return 0, err
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		return 0, err
+	}
+	var reply protocol.Envelope
+	if err := conn.ReadJSON(&reply); err != nil {
+		return 0, err
+	}
+	switch reply.Type {
+	case protocol.TypeWelcome:
+		var welcome protocol.WelcomePayload
+		if err := reply.Decode(&welcome); err != nil {
+			return 0, err
 		}
+		fmt.Println("Server: " + welcome.Message)
+		return welcome.Version, nil
+	case protocol.TypeError:
+		var failure protocol.ErrorPayload
+		if err := reply.Decode(&failure); err != nil {
+			return 0, err
+		}
+		return 0, errors.New(failure.Message)
+	default:
+		return 0, errors.New("Unexpected " + reply.Type + " frame")
 	}
 }
 
 // readInput - Reads input from stdin to build and queue outbound messages
-func readInput(conn *websocket.Conn) {
-	reader := bufio.NewReader(os.Stdin)
+func readInput() {
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := stdin.ReadString('\n')
 		if err != nil {
 			fmt.Println("Error: Unable to read input")
+			close(quit)
 			break
 		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 
-		command, body := helpers.SplitOnFirstDelim(' ', line)
-		message := models.Message{Command: command, Body: body}
-
-		switch command {
-		case "login":
-			fallthrough
-		case "newuser":
-			handle, pass := helpers.SplitOnFirstDelim(' ', message.Body)
-			message.Client = models.Client{
-				Handle: handle,
-				Pass:   pass,
-			}
-			fallthrough
-		case "send":
-			fallthrough
-		case "logout":
-			outboundMessages <- message
-		case "help":
-			fmt.Println("Available commands:")
-			fmt.Println("- login <handle> <pass> - Log in to server")
-			fmt.Println("- newuser <handle> <pass> - Register new user")
-			fmt.Println("- send <message> - Send message to clients")
-			fmt.Println("- logout - Log out from server")
-		default:
-			fmt.Println("Type 'help' to get a list available commands")
+		// The server validates commands and answers unknown ones, so every line is forwarded
+		frame, err := protocol.ParseLine(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
 		}
+		outboundMessages <- frame
 	}
 }
 
 // printMessages - Print queued incoming messages to stdin
 func printMessages() {
 	for {
-		var body string
-		message := <-inboundMessages
-		client := message.GetClient()
-		if client != nil && client.GetHandle() != "" {
-			body = client.GetHandle() + ": " + message.GetBody()
-		} else {
-			body = message.GetBody()
+		frame := <-inboundMessages
+		if body, ok := formatFrame(frame); ok {
+			fmt.Println(body)
+		}
+	}
+}
+
+// formatFrame - Describe a frame from the server for display
+func formatFrame(frame protocol.Envelope) (string, bool) {
+	switch frame.Type {
+	case protocol.TypeChat:
+		var chat protocol.ChatPayload
+		if err := frame.Decode(&chat); err != nil {
+			return "", false
+		}
+		return strings.Join(chatLines(chat, ""), "\n"), true
+	case protocol.TypeEdited:
+		var chat protocol.ChatPayload
+		if err := frame.Decode(&chat); err != nil {
+			return "", false
+		}
+		return strings.Join(chatLines(chat, ""), "\n"), true
+	case protocol.TypeDeleted:
+		var deleted protocol.DeletedPayload
+		if err := frame.Decode(&deleted); err != nil {
+			return "", false
+		}
+		return idPrefix(deleted.ID) + roomPrefix(deleted.Room) + "Message deleted by " + deleted.By, true
+	case protocol.TypeReactions:
+		var reactions protocol.ReactionsPayload
+		if err := frame.Decode(&reactions); err != nil {
+			return "", false
+		}
+		if len(reactions.Reactions) == 0 {
+			return idPrefix(reactions.ID) + roomPrefix(reactions.Room) + "No reactions", true
+		}
+		return idPrefix(reactions.ID) + roomPrefix(reactions.Room) + "Reactions: " + formatReactions(reactions.Reactions), true
+	case protocol.TypeThread:
+		var thread protocol.ThreadPayload
+		if err := frame.Decode(&thread); err != nil {
+			return "", false
+		}
+		lines := []string{"--- Thread #" + thread.ID + " ---"}
+		for _, chat := range thread.Messages {
+			lines = append(lines, chatLines(chat, chat.Sent.Local().Format("Jan 2 15:04")+" ")...)
+		}
+		lines = append(lines, "--- End of thread ---")
+		return strings.Join(lines, "\n"), true
+	case protocol.TypeHistory:
+		var history protocol.HistoryPayload
+		if err := frame.Decode(&history); err != nil {
+			return "", false
+		}
+		if len(history.Messages) == 0 {
+			return "--- No messages ---", true
+		}
+		lines := []string{"--- Recent messages ---"}
+		for _, chat := range history.Messages {
+			lines = append(lines, chatLines(chat, chat.Sent.Local().Format("Jan 2 15:04")+" ")...)
+		}
+		lines = append(lines, "--- End of history ---")
+		return strings.Join(lines, "\n"), true
+	case protocol.TypeSearchResults:
+		var results protocol.SearchResultsPayload
+		if err := frame.Decode(&results); err != nil {
+			return "", false
+		}
+		if results.Total == 0 {
+			return "--- No messages match '" + results.Query + "' ---", true
+		}
+		lines := []string{fmt.Sprintf("--- %d messages match '%s' - page %d of %d ---", results.Total, results.Query, results.Page, results.Pages)}
+		for _, chat := range results.Messages {
+			lines = append(lines, chatLines(chat, chat.Sent.Local().Format("Jan 2 15:04")+" ")...)
+		}
+		if results.Page < results.Pages {
+			lines = append(lines, fmt.Sprintf("--- Add page:%d to see more ---", results.Page+1))
 		}
-		fmt.Println(body)
+		return strings.Join(lines, "\n"), true
+	case protocol.TypeNotice:
+		var notice protocol.NoticePayload
+		if err := frame.Decode(&notice); err != nil {
+			return "", false
+		}
+		return roomPrefix(notice.Room) + "Server: " + notice.Message, true
+	case protocol.TypeError:
+		var failure protocol.ErrorPayload
+		if err := frame.Decode(&failure); err != nil {
+			return "", false
+		}
+		return "Error: " + failure.Message, true
+	default:
+		return "", false
+	}
+}
+
+// chatLines - Describe a message, with prefix, preceded by the quote of the message it replies to
+func chatLines(chat protocol.ChatPayload, prefix string) []string {
+	lines := []string{}
+	if chat.Quote != nil {
+		quote := strings.Repeat(" ", len(prefix)) + "  > " + idPrefix(chat.ReplyTo) + chat.Quote.From + ": " + chat.Quote.Text
+		lines = append(lines, quote)
+	}
+	return append(lines, prefix+formatChat(chat))
+}
+
+// formatChat - Describe a message sent to a room or user
+// The message ID is shown so the message can be edited or deleted
+func formatChat(chat protocol.ChatPayload) string {
+	text := chat.Message
+	if chat.Edited != nil {
+		text += " (edited)"
+	}
+	if len(chat.Reactions) > 0 {
+		text += " [" + formatReactions(chat.Reactions) + "]"
 	}
+	if chat.To != "" {
+		return idPrefix(chat.ID) + "[dm] " + chat.From + " -> " + chat.To + ": " + text
+	}
+	return idPrefix(chat.ID) + roomPrefix(chat.Room) + chat.From + ": " + text
+}
+
+// formatReactions - Describe the reactions to a message, such as "👍 2, 🎉 1"
+func formatReactions(reactions []protocol.ReactionPayload) string {
+	counts := make([]string, len(reactions))
+	for i, reaction := range reactions {
+		counts[i] = fmt.Sprintf("%s %d", reaction.Emoji, reaction.Count)
+	}
+	return strings.Join(counts, ", ")
+}
+
+// idPrefix - Prefix identifying a recorded message
+func idPrefix(id string) string {
+	if id == "" {
+		return ""
+	}
+	return "#" + id + " "
+}
+
+// roomPrefix - Prefix identifying the room a message belongs to
+func roomPrefix(room string) string {
+	if room == "" {
+		return ""
+	}
+	return "[" + room + "] "
 }
 
 // receiveMessages - Recieve and queue messages from server
-func receiveMessages(conn *websocket.Conn, wg *sync.WaitGroup) {
-	defer wg.Done()
+// received is closed when the connection can no longer be read or the server goes silent for longer than -server-timeout
+func receiveMessages(conn *websocket.Conn, received chan struct{}) {
+	defer close(received)
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(*serverTimeout))
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
 	for {
-		var demarshaled struct {
-			Command string
-			Body    string
-			Client  models.Client
+		var frame protocol.Envelope
+		conn.SetReadDeadline(time.Now().Add(*serverTimeout))
+		err := conn.ReadJSON(&frame)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			fmt.Println("Client: Server stopped responding")
+			break
+		}
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			fmt.Println("Client: Server closed connection -", closeErr.Text)
+			break
 		}
-		err := conn.ReadJSON(&demarshaled)
 		if err != nil {
 			fmt.Println("Error: Unable to read message from server")
 			break
 		}
-		message := models.Message{
-			Command: demarshaled.Command,
-			Body:    demarshaled.Body,
-			Client:  demarshaled.Client,
+		for _, restore := range session.observe(frame) {
+			outboundMessages <- restore
 		}
-		inboundMessages <- message
+		inboundMessages <- frame
 	}
 }
 
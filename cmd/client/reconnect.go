@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+var reconnect = flag.Bool("reconnect", true, "Reconnect automatically when the connection is lost")
+var minBackoff = flag.Duration("min-backoff", 500*time.Millisecond, "Delay before the first reconnect attempt")
+var maxBackoff = flag.Duration("max-backoff", 30*time.Second, "Longest delay between reconnect attempts")
+var serverTimeout = flag.Duration("server-timeout", 75*time.Second, "Treat the connection as lost when the server sends nothing, not even a ping, for this long")
+
+// backoff - Returns the delay before reconnect attempt number attempt
+// The delay doubles with every attempt up to max, with up to half of it randomized to spread out reconnecting clients
+func backoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// sessionState - What the client restores after reconnecting
+// It is built by observing the frames exchanged with the server
+// The session token is preferred over the password when logging back in
+type sessionState struct {
+	mutex  sync.Mutex
+	handle string
+	pass   string
+	token  string
+	rooms  []string
+	// pending - Credentials of a login sent but not yet accepted by the server
+	pending *protocol.CredentialsPayload
+}
+
+// track - Record the effect of a frame sent to the server
+func (s *sessionState) track(frame protocol.Envelope) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch frame.Type {
+	case "login":
+		// Credentials are only kept once the server accepts them, so a failed login is not repeated on reconnect
+		var credentials protocol.CredentialsPayload
+		if frame.Decode(&credentials) == nil {
+			s.pending = &credentials
+		}
+	case "logout":
+		s.handle, s.pass, s.token, s.rooms, s.pending = "", "", "", nil, nil
+	case "join":
+		var room protocol.RoomPayload
+		if frame.Decode(&room) == nil {
+			s.rooms = append(withoutRoom(s.rooms, room.Room), room.Room)
+		}
+	case "leave":
+		var room protocol.RoomPayload
+		if frame.Decode(&room) == nil {
+			s.rooms = withoutRoom(s.rooms, room.Room)
+		}
+	}
+}
+
+// observe - Record the effect of a frame received from the server
+// Returns frames that finish restoring the session after a resume succeeds or fails
+func (s *sessionState) observe(frame protocol.Envelope) []protocol.Envelope {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch frame.Type {
+	case protocol.TypeSession:
+		var payload protocol.SessionPayload
+		if frame.Decode(&payload) != nil {
+			return nil
+		}
+		if s.pending != nil && !payload.Resumed && s.pending.Handle == payload.Handle {
+			s.pass = s.pending.Pass
+			// The server joins the lobby on login
+			s.rooms = []string{"lobby"}
+		}
+		s.pending = nil
+		s.handle, s.token = payload.Handle, payload.Token
+		if payload.Resumed {
+			return s.rejoinFrames()
+		}
+	case protocol.TypeError:
+		var failure protocol.ErrorPayload
+		if frame.Decode(&failure) != nil || failure.Code != protocol.CodeSessionExpired {
+			return nil
+		}
+		s.token = ""
+		if s.pass != "" {
+			return s.loginFrames()
+		}
+	}
+	return nil
+}
+
+// restoreFrames - Frames that log back in and rejoin rooms in the order they were joined
+// With a session token only the resume frame is sent; rooms are rejoined once the server accepts it
+func (s *sessionState) restoreFrames() []protocol.Envelope {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// A login sent on the lost connection will never be answered
+	s.pending = nil
+	if s.handle == "" {
+		return []protocol.Envelope{}
+	}
+	if s.token != "" {
+		if resume, err := protocol.NewEnvelope("resume", protocol.ResumePayload{Token: s.token}); err == nil {
+			return []protocol.Envelope{resume}
+		}
+	}
+	return s.loginFrames()
+}
+
+// loginFrames - Frames that log in with the password and rejoin rooms
+// The caller must hold the mutex
+func (s *sessionState) loginFrames() []protocol.Envelope {
+	frames := []protocol.Envelope{}
+	if s.pass == "" {
+		return frames
+	}
+	login, err := protocol.NewEnvelope("login", protocol.CredentialsPayload{Handle: s.handle, Pass: s.pass})
+	if err != nil {
+		return frames
+	}
+	frames = append(frames, login)
+	return append(frames, s.rejoinFrames()...)
+}
+
+// rejoinFrames - Frames that rejoin rooms in the order they were joined
+// The caller must hold the mutex
+func (s *sessionState) rejoinFrames() []protocol.Envelope {
+	frames := []protocol.Envelope{}
+	for _, room := range s.rooms {
+		if join, err := protocol.NewEnvelope("join", protocol.RoomPayload{Room: room}); err == nil {
+			frames = append(frames, join)
+		}
+	}
+	// Rejoining moves a room to the end, so leave the lobby again if it was left before
+	if len(withoutRoom(s.rooms, "lobby")) == len(s.rooms) {
+		if leave, err := protocol.NewEnvelope("leave", protocol.RoomPayload{Room: "lobby"}); err == nil {
+			frames = append(frames, leave)
+		}
+	}
+	return frames
+}
+
+// withoutRoom - Returns rooms with room removed
+func withoutRoom(rooms []string, room string) []string {
+	kept := make([]string, 0, len(rooms))
+	for _, r := range rooms {
+		if r != room {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
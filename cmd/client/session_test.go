@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// testFrame - Build a frame of frameType carrying payload
+func testFrame(t *testing.T, frameType string, payload interface{}) protocol.Envelope {
+	t.Helper()
+	envelope, err := protocol.NewEnvelope(frameType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func TestFailedLoginIsNotRestored(t *testing.T) {
+	session := &sessionState{}
+	session.track(testFrame(t, "login", protocol.CredentialsPayload{Handle: "beth", Pass: "wrong"}))
+	session.observe(testFrame(t, protocol.TypeError, protocol.ErrorPayload{Code: protocol.CodeUnauthorized, Message: "Unable to log in"}))
+	if restore := session.restoreFrames(); len(restore) != 0 {
+		t.Errorf("Reconnecting after a failed login sends %d frames, want none", len(restore))
+	}
+}
+
+func TestAcceptedLoginIsRestored(t *testing.T) {
+	session := &sessionState{}
+	session.track(testFrame(t, "login", protocol.CredentialsPayload{Handle: "beth", Pass: "secret"}))
+	session.observe(testFrame(t, protocol.TypeSession, protocol.SessionPayload{Handle: "beth", Token: "token"}))
+	// A wrong password tried while logged in must not replace the accepted one
+	session.track(testFrame(t, "login", protocol.CredentialsPayload{Handle: "beth", Pass: "wrong"}))
+	session.observe(testFrame(t, protocol.TypeError, protocol.ErrorPayload{Code: protocol.CodeConflict, Message: "Client is already logged in"}))
+
+	restore := session.restoreFrames()
+	if len(restore) != 1 || restore[0].Type != "resume" {
+		t.Fatalf("Reconnecting sends %v, want a resume frame", restore)
+	}
+	// The token expired while disconnected, so the client logs in with the accepted password
+	retry := session.observe(testFrame(t, protocol.TypeError, protocol.ErrorPayload{Code: protocol.CodeSessionExpired, Message: "Session has expired"}))
+	if len(retry) == 0 || retry[0].Type != "login" {
+		t.Fatalf("Expired session is retried with %v, want a login frame", retry)
+	}
+	var credentials protocol.CredentialsPayload
+	if err := retry[0].Decode(&credentials); err != nil {
+		t.Fatal(err)
+	}
+	if credentials.Handle != "beth" || credentials.Pass != "secret" {
+		t.Errorf("Retried login with %+v, want beth and the accepted password", credentials)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// settings - Connection settings for a session
+type settings struct {
+	// Server - URL of the server, ws:// or wss://
+	Server string `json:"server"`
+	// Handle - Handle to log in with automatically after connecting
+	Handle string `json:"handle"`
+	// CA - PEM file of certificate authorities to trust
+	CA string `json:"ca"`
+	// ServerName - Host name verified against the server certificate
+	ServerName string `json:"serverName"`
+	// Insecure - Skip server certificate verification
+	Insecure bool `json:"insecure"`
+	// Credentials - Where the password for Handle comes from: prompt, env, file or none
+	Credentials string `json:"credentials"`
+}
+
+// profiles - Contents of the profile file
+type profiles struct {
+	// Default - Profile used when -profile is not provided
+	Default string `json:"default"`
+	// Profiles - Named server entries
+	Profiles map[string]settings `json:"profiles"`
+}
+
+var serverURL = flag.String("server", "ws://localhost:11631", "Server URL, ws:// or wss://")
+var handle = flag.String("handle", "", "Handle to log in with automatically after connecting")
+var caFile = flag.String("ca", "", "PEM file of certificate authorities to trust in addition to the system pool")
+var serverName = flag.String("server-name", "", "Override the host name verified against the server certificate")
+var insecure = flag.Bool("insecure", false, "Skip server certificate verification (development only)")
+var credentialSource = flag.String("credentials", "prompt", "Source of the password for -handle: prompt, env ("+passEnv+"), file or none")
+var saveCredentials = flag.Bool("save-credentials", false, "Save the password to the encrypted credentials file after prompting")
+var profileName = flag.String("profile", "", "Named profile to load from the profile file")
+var profilePath = flag.String("profiles", defaultConfigPath("profiles.json"), "Profile file")
+
+// defaultConfigPath - Returns the path of name in the user's websocketLab config directory
+func defaultConfigPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(dir, "websocketLab", name)
+}
+
+// resolveSettings - Combine the selected profile with the command line flags
+// Flags provided on the command line take precedence over the profile
+func resolveSettings() (settings, error) {
+	resolved := settings{
+		Server:      *serverURL,
+		Credentials: *credentialSource,
+	}
+	name := *profileName
+	contents, err := loadProfiles(*profilePath)
+	if err != nil {
+		return resolved, err
+	}
+	if name == "" {
+		name = contents.Default
+	}
+	if name != "" {
+		profile, ok := contents.Profiles[name]
+		if !ok {
+			return resolved, errors.New("Profile " + name + " not found in " + *profilePath)
+		}
+		if profile.Server != "" {
+			resolved.Server = profile.Server
+		}
+		if profile.Credentials != "" {
+			resolved.Credentials = profile.Credentials
+		}
+		resolved.Handle = profile.Handle
+		resolved.CA = profile.CA
+		resolved.ServerName = profile.ServerName
+		resolved.Insecure = profile.Insecure
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "server":
+			resolved.Server = *serverURL
+		case "handle":
+			resolved.Handle = *handle
+		case "ca":
+			resolved.CA = *caFile
+		case "server-name":
+			resolved.ServerName = *serverName
+		case "insecure":
+			resolved.Insecure = *insecure
+		case "credentials":
+			resolved.Credentials = *credentialSource
+		}
+	})
+	return resolved, nil
+}
+
+// loadProfiles - Read the profile file at path; a missing file has no profiles
+func loadProfiles(path string) (profiles, error) {
+	var contents profiles
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return contents, nil
+	}
+	if err != nil {
+		return contents, err
+	}
+	defer file.Close()
+	err = json.NewDecoder(file).Decode(&contents)
+	return contents, err
+}
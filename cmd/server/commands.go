@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// command - Describes a command supported by the server
+type command struct {
+	// Name - Name the client uses to invoke the command
+	Name string
+	// Description - Short summary of what the command does
+	Description string
+	// Auth - Command may only be used by logged in clients
+	Auth bool
+	// Handler - Processes a request for the command
+	Handler func(request)
+}
+
+// usage - Describe how to invoke the command
+// Arguments are declared alongside the command's payload in the protocol package
+func (c command) usage() string {
+	return protocol.Usage(c.Name)
+}
+
+// commandRegistry - Commands supported by the server
+type commandRegistry struct {
+	mutex    sync.RWMutex
+	commands map[string]command
+	order    []string
+}
+
+// newCommandRegistry - Create an empty command registry
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{commands: make(map[string]command)}
+}
+
+// register - Add cmd to the registry, replacing any command with the same name
+func (r *commandRegistry) register(cmd command) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.commands[cmd.Name]; !ok {
+		r.order = append(r.order, cmd.Name)
+	}
+	r.commands[cmd.Name] = cmd
+}
+
+// lookup - Returns the command called name
+func (r *commandRegistry) lookup(name string) (command, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+// list - Returns every command in the order they were registered
+func (r *commandRegistry) list() []command {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	list := make([]command, 0, len(r.order))
+	for _, name := range r.order {
+		list = append(list, r.commands[name])
+	}
+	return list
+}
+
+// verify - Ensures the registered commands are exactly the commands declared in protocol.Commands
+// Arguments are declared in the protocol package and handlers here, so a command missing from either would be unusable
+func (r *commandRegistry) verify() error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var problems []string
+	for name := range r.commands {
+		if _, ok := protocol.Commands[name]; !ok {
+			problems = append(problems, name+" is registered but has no arguments declared in protocol.Commands")
+		}
+	}
+	for name := range protocol.Commands {
+		if _, ok := r.commands[name]; !ok {
+			problems = append(problems, name+" is declared in protocol.Commands but not registered")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("Command registry does not match protocol - %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// registerCommands - Register the commands supported by the server
+// Commands that validate client input enforce the provided limits
+// Logging in replays the last replay messages the client may see
+// Moderators may edit and delete any message
+// Fails if the registered commands do not match protocol.Commands
+func registerCommands(limits limits, replay int, moderators map[string]bool) error {
+	commands.register(command{
+		Name:        "login",
+		Description: "Log in to server",
+		Handler:     processLogin(replay),
+	})
+	commands.register(command{
+		Name:        "resume",
+		Description: "Log back in with the session token issued at login",
+		Handler:     processResume,
+	})
+	commands.register(command{
+		Name:        "newuser",
+		Description: "Register new user",
+		Handler:     processNewUser(limits),
+	})
+	commands.register(command{
+		Name:        "send",
+		Description: "Send message to your current room",
+		Auth:        true,
+		Handler:     processSend(limits.MaxMessage),
+	})
+	commands.register(command{
+		Name:        "msg",
+		Description: "Send a direct message to a user",
+		Auth:        true,
+		Handler:     processMsg(limits.MaxMessage),
+	})
+	commands.register(command{
+		Name:        "reply",
+		Description: "Reply to a message, starting or continuing its thread",
+		Auth:        true,
+		Handler:     processReply(limits.MaxMessage),
+	})
+	commands.register(command{
+		Name:        "thread",
+		Description: "Show the thread a message belongs to",
+		Auth:        true,
+		Handler:     processThread,
+	})
+	commands.register(command{
+		Name:        "edit",
+		Description: "Replace the text of a message you sent",
+		Auth:        true,
+		Handler:     processEdit(moderators, limits.MaxMessage),
+	})
+	commands.register(command{
+		Name:        "delete",
+		Description: "Delete a message you sent",
+		Auth:        true,
+		Handler:     processDelete(moderators),
+	})
+	commands.register(command{
+		Name:        "react",
+		Description: "React to a message with an emoji",
+		Auth:        true,
+		Handler:     processReact(limits),
+	})
+	commands.register(command{
+		Name:        "unreact",
+		Description: "Remove your reaction to a message",
+		Auth:        true,
+		Handler:     processUnreact,
+	})
+	commands.register(command{
+		Name:        "join",
+		Description: "Join a room, creating it if needed, and make it your current room",
+		Auth:        true,
+		Handler:     processJoin(limits),
+	})
+	commands.register(command{
+		Name:        "leave",
+		Description: "Leave a room",
+		Auth:        true,
+		Handler:     processLeave,
+	})
+	commands.register(command{
+		Name:        "rooms",
+		Description: "List rooms and their member counts",
+		Auth:        true,
+		Handler:     processRooms,
+	})
+	commands.register(command{
+		Name:        "history",
+		Description: "Show recent messages from your rooms and direct messages",
+		Auth:        true,
+		Handler:     processHistory(limits.MaxHistory),
+	})
+	commands.register(command{
+		Name:        "search",
+		Description: "Search messages you can see; filter with from:<handle>, room:<name>, before:<date>, after:<date> and page:<n>",
+		Auth:        true,
+		Handler:     processSearch(limits.SearchPage),
+	})
+	commands.register(command{
+		Name:        "logout",
+		Description: "Log out from server and revoke your session token",
+		Handler:     processLogout,
+	})
+	commands.register(command{
+		Name:        "help",
+		Description: "List available commands",
+		Handler:     processHelp,
+	})
+	return commands.verify()
+}
+
+// helpText - Describe every command supported by the server
+func helpText() string {
+	lines := []string{"Available commands:"}
+	for _, cmd := range commands.list() {
+		lines = append(lines, "- "+cmd.usage()+" - "+cmd.Description)
+	}
+	return strings.Join(lines, "\n")
+}
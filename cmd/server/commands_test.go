@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegisteredCommandsMatchProtocol(t *testing.T) {
+	saved := commands
+	defer func() { commands = saved }()
+	commands = newCommandRegistry()
+
+	if err := registerCommands(defaultConfig().Limits, 0, nil); err != nil {
+		t.Fatalf("registerCommands returned error: %v", err)
+	}
+}
+
+func TestVerifyReportsMismatchedCommands(t *testing.T) {
+	registry := newCommandRegistry()
+	registry.register(command{Name: "bogus", Handler: func(request) {}})
+
+	err := registry.verify()
+	if err == nil {
+		t.Fatal("verify accepted a command missing from protocol.Commands")
+	}
+	for _, name := range []string{"bogus", "login"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("verify error %q does not mention %s", err, name)
+		}
+	}
+}
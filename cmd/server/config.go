@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix - Prefix of the environment variables read by the server
+const envPrefix = "WEBSOCKETLAB_"
+
+// config - Server settings
+// Settings are resolved in order of increasing precedence:
+// built-in defaults, the JSON config file, WEBSOCKETLAB_* environment variables, then command line flags
+type config struct {
+	// Host - Address to listen on; empty listens on every interface
+	Host string `json:"host"`
+	// Port - Port to listen on
+	Port int `json:"port"`
+	// Path - HTTP path that accepts websocket upgrades
+	Path string `json:"path"`
+	// Store - User store backend: file, memory or sqlite
+	Store string `json:"store"`
+	// Users - Path to the user store file or SQLite database
+	Users string `json:"users"`
+	// MessageStore - Message history backend: file or memory
+	MessageStore string `json:"messageStore"`
+	// Messages - Path to the message history file
+	Messages string `json:"messages"`
+	// Moderators - Comma separated handles that may edit and delete any message
+	Moderators string `json:"moderators"`
+	// HistoryReplay - Recent messages sent after login
+	HistoryReplay int `json:"historyReplay"`
+	// QueueSize - Outbound messages buffered per connection
+	QueueSize int `json:"queueSize"`
+	// QueuePolicy - Action when a connection's queue is full
+	QueuePolicy string `json:"queuePolicy"`
+	// Cert - TLS certificate file
+	Cert string `json:"cert"`
+	// Key - TLS private key file
+	Key string `json:"key"`
+	// SelfSigned - Serve TLS with a generated self-signed certificate
+	SelfSigned bool `json:"selfSigned"`
+	// SelfSignedHosts - Comma separated hosts the self-signed certificate is valid for
+	SelfSignedHosts string `json:"selfSignedHosts"`
+	// SelfSignedOut - File to write the generated self-signed certificate to
+	SelfSignedOut string `json:"selfSignedOut"`
+	// AllowedOrigins - Comma separated origins allowed to connect; *. matches any subdomain
+	AllowedOrigins string `json:"allowedOrigins"`
+	// AllowNoOrigin - Accept requests without an Origin header, as sent by native clients
+	AllowNoOrigin bool `json:"allowNoOrigin"`
+	// PingInterval - Time between pings sent to each client
+	PingInterval duration `json:"pingInterval"`
+	// PongTimeout - Time a client has to answer before it is disconnected
+	PongTimeout duration `json:"pongTimeout"`
+	// RateLimits - Comma separated per command limits such as "*=5/10,send=2/5", in requests per second/burst
+	RateLimits string `json:"rateLimits"`
+	// RateStrikes - Throttled requests allowed per minute before a client is disconnected
+	RateStrikes int `json:"rateStrikes"`
+	// LoginHandleLimit - Login attempts allowed per handle, in attempts per second/burst
+	LoginHandleLimit string `json:"loginHandleLimit"`
+	// LoginIPLimit - Login attempts allowed per remote IP, in attempts per second/burst
+	LoginIPLimit string `json:"loginIpLimit"`
+	// SessionTTL - Time a session token stays valid without use
+	SessionTTL duration `json:"sessionTtl"`
+	// ShutdownTimeout - Time allowed to flush outbound queues when shutting down
+	ShutdownTimeout duration `json:"shutdownTimeout"`
+	// Limits - Validation limits applied to client input
+	Limits limits `json:"limits"`
+}
+
+// duration - time.Duration written as a string such as "5s" in config files
+type duration time.Duration
+
+// UnmarshalJSON - Parse a duration string such as "5s"
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// limits - Validation limits applied to client input
+type limits struct {
+	// MaxHandle - Maximum length of a handle
+	MaxHandle int `json:"maxHandle"`
+	// MinPass - Minimum length of a password
+	MinPass int `json:"minPass"`
+	// MaxPass - Maximum length of a password
+	MaxPass int `json:"maxPass"`
+	// MaxRoom - Maximum length of a room name
+	MaxRoom int `json:"maxRoom"`
+	// MaxHistory - Maximum number of messages returned by history
+	MaxHistory int `json:"maxHistory"`
+	// SearchPage - Number of messages in each page of search results
+	SearchPage int `json:"searchPage"`
+	// MaxMessage - Maximum length of a message in bytes
+	MaxMessage int `json:"maxMessage"`
+	// MaxEmoji - Maximum length in bytes of the emoji of a reaction, enough for emoji joined from several code points
+	MaxEmoji int `json:"maxEmoji"`
+	// MaxReactions - Maximum number of different emoji a message may be reacted to with
+	MaxReactions int `json:"maxReactions"`
+}
+
+// frameOverhead - Room left in a frame for everything but the message text
+const frameOverhead = 4096
+
+// frameLimit - Largest frame a client may send
+// JSON escapes each byte of the message as at most six characters
+func (l limits) frameLimit() int64 {
+	return int64(l.MaxMessage)*6 + frameOverhead
+}
+
+// option - A setting that can be provided by flag or environment variable
+type option struct {
+	name   string
+	usage  string
+	set    func(value string) error
+	value  func() string
+	isBool bool
+}
+
+// defaultConfig - Returns the built-in server settings
+func defaultConfig() *config {
+	return &config{
+		Port:             11631,
+		Path:             "/",
+		Store:            "file",
+		Users:            "users.txt",
+		MessageStore:     "file",
+		Messages:         "messages.jsonl",
+		HistoryReplay:    20,
+		QueueSize:        64,
+		QueuePolicy:      string(dropOldest),
+		SelfSignedHosts:  "localhost,127.0.0.1",
+		AllowNoOrigin:    true,
+		PingInterval:     duration(30 * time.Second),
+		PongTimeout:      duration(60 * time.Second),
+		RateLimits:       "*=5/10,send=2/5,msg=2/5,newuser=0.1/5",
+		RateStrikes:      10,
+		LoginHandleLimit: "0.1/5",
+		LoginIPLimit:     "0.5/20",
+		SessionTTL:       duration(24 * time.Hour),
+		ShutdownTimeout:  duration(5 * time.Second),
+		Limits: limits{
+			MaxHandle:    32,
+			MinPass:      4,
+			MaxPass:      8,
+			MaxRoom:      32,
+			MaxHistory:   100,
+			SearchPage:   10,
+			MaxMessage:   4096,
+			MaxEmoji:     32,
+			MaxReactions: 20,
+		},
+	}
+}
+
+// options - Settings of c that can be provided by flag or environment variable
+func (c *config) options() []option {
+	return []option{
+		stringOption("host", "Address to listen on; empty listens on every interface", &c.Host),
+		intOption("port", "Port to listen on", &c.Port),
+		stringOption("path", "HTTP path that accepts websocket upgrades", &c.Path),
+		stringOption("store", "User store backend: file, memory or sqlite", &c.Store),
+		stringOption("users", "Path to the user store file or SQLite database", &c.Users),
+		stringOption("message-store", "Message history backend: file or memory", &c.MessageStore),
+		stringOption("messages", "Path to the message history file", &c.Messages),
+		stringOption("moderators", "Comma separated handles that may edit and delete any message", &c.Moderators),
+		intOption("history-replay", "Recent messages sent after login; 0 disables the replay", &c.HistoryReplay),
+		intOption("queue-size", "Number of outbound messages buffered per connection", &c.QueueSize),
+		stringOption("queue-policy", "Action when a connection's queue is full: drop-oldest, drop-newest or disconnect", &c.QueuePolicy),
+		stringOption("cert", "TLS certificate file; enables wss:// together with -key", &c.Cert),
+		stringOption("key", "TLS private key file", &c.Key),
+		boolOption("self-signed", "Serve wss:// with a generated self-signed certificate (development only)", &c.SelfSigned),
+		stringOption("self-signed-hosts", "Comma separated hosts the self-signed certificate is valid for", &c.SelfSignedHosts),
+		stringOption("self-signed-out", "File to write the generated self-signed certificate to, for use with the client's -ca flag", &c.SelfSignedOut),
+		stringOption("allowed-origins", "Comma separated origins allowed to connect, such as https://chat.example.com or https://*.example.com; empty allows same-origin requests only", &c.AllowedOrigins),
+		boolOption("allow-no-origin", "Accept requests without an Origin header, as sent by native clients", &c.AllowNoOrigin),
+		durationOption("ping-interval", "Time between pings sent to each client", &c.PingInterval),
+		durationOption("pong-timeout", "Time a client has to answer before it is disconnected; must exceed -ping-interval", &c.PongTimeout),
+		stringOption("rate-limits", "Comma separated per command limits in requests per second/burst, such as *=5/10,send=2/5; * applies to every other command", &c.RateLimits),
+		intOption("rate-strikes", "Throttled requests allowed per minute before a client is disconnected", &c.RateStrikes),
+		stringOption("login-handle-limit", "Login attempts allowed per handle, in attempts per second/burst", &c.LoginHandleLimit),
+		stringOption("login-ip-limit", "Login attempts allowed per remote IP, in attempts per second/burst", &c.LoginIPLimit),
+		durationOption("session-ttl", "Time a session token stays valid without use", &c.SessionTTL),
+		durationOption("shutdown-timeout", "Time allowed to flush outbound queues when shutting down", &c.ShutdownTimeout),
+		intOption("max-handle", "Maximum length of a handle", &c.Limits.MaxHandle),
+		intOption("min-pass", "Minimum length of a password", &c.Limits.MinPass),
+		intOption("max-pass", "Maximum length of a password", &c.Limits.MaxPass),
+		intOption("max-room", "Maximum length of a room name", &c.Limits.MaxRoom),
+		intOption("max-history", "Maximum number of messages returned by history", &c.Limits.MaxHistory),
+		intOption("search-page", "Number of messages in each page of search results", &c.Limits.SearchPage),
+		intOption("max-message", "Maximum length of a message in bytes", &c.Limits.MaxMessage),
+		intOption("max-emoji", "Maximum length of the emoji of a reaction in bytes", &c.Limits.MaxEmoji),
+		intOption("max-reactions", "Maximum number of different emoji a message may be reacted to with", &c.Limits.MaxReactions),
+	}
+}
+
+// loadConfig - Resolve the server settings from defaults, config file, environment and args
+func loadConfig(args []string) (*config, error) {
+	c := defaultConfig()
+	options := c.options()
+
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv(envPrefix+"CONFIG"), "JSON config file (env "+envPrefix+"CONFIG)")
+	provided := make(map[string]string)
+	for _, opt := range options {
+		flags.Var(&recordedFlag{name: opt.name, value: opt.value(), isBool: opt.isBool, provided: provided}, opt.name, opt.usage+" (env "+envName(opt.name)+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, opt := range options {
+		if value, ok := os.LookupEnv(envName(opt.name)); ok {
+			if err := opt.set(value); err != nil {
+				return nil, fmt.Errorf("Invalid %s: %v", envName(opt.name), err)
+			}
+		}
+	}
+	for _, opt := range options {
+		if value, ok := provided[opt.name]; ok {
+			if err := opt.set(value); err != nil {
+				return nil, fmt.Errorf("Invalid -%s: %v", opt.name, err)
+			}
+		}
+	}
+	return c, c.validate()
+}
+
+// loadFile - Apply the settings in the JSON file at path
+func (c *config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("Invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// validate - Ensures the settings are usable
+func (c *config) validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return errors.New("Port must be between 1 and 65535")
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return errors.New("Path must start with /")
+	}
+	if c.Store != "file" && c.Store != "memory" && c.Store != "sqlite" {
+		return fmt.Errorf("Unknown user store %q", c.Store)
+	}
+	if c.MessageStore != "file" && c.MessageStore != "memory" {
+		return fmt.Errorf("Unknown message store %q", c.MessageStore)
+	}
+	if c.HistoryReplay < 0 || c.Limits.MaxHistory < 1 {
+		return errors.New("History replay must not be negative and max history must be at least 1")
+	}
+	if c.Limits.SearchPage < 1 {
+		return errors.New("Search page size must be at least 1")
+	}
+	if c.QueueSize < 1 {
+		return errors.New("Queue size must be at least 1")
+	}
+	if _, err := parseOverflowPolicy(c.QueuePolicy); err != nil {
+		return err
+	}
+	if _, err := parseOrigins(c.AllowedOrigins); err != nil {
+		return err
+	}
+	if c.PingInterval <= 0 || c.PongTimeout <= c.PingInterval {
+		return errors.New("Pong timeout must be greater than a positive ping interval")
+	}
+	if _, err := newRateLimiter(c.RateLimits, c.RateStrikes, c.LoginHandleLimit, c.LoginIPLimit); err != nil {
+		return err
+	}
+	if c.RateStrikes < 1 {
+		return errors.New("Rate strikes must be at least 1")
+	}
+	if c.SessionTTL <= 0 {
+		return errors.New("Session TTL must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("Shutdown timeout must be positive")
+	}
+	if c.Limits.MaxHandle < 1 || c.Limits.MaxRoom < 1 {
+		return errors.New("Handle and room limits must be at least 1")
+	}
+	if c.Limits.MinPass < 1 || c.Limits.MaxPass < c.Limits.MinPass {
+		return errors.New("Password limits must satisfy 1 <= min-pass <= max-pass")
+	}
+	if c.Limits.MaxMessage < 1 {
+		return errors.New("Message limit must be at least 1")
+	}
+	if c.Limits.MaxEmoji < 1 || c.Limits.MaxReactions < 1 {
+		return errors.New("Emoji and reaction limits must be at least 1")
+	}
+	return nil
+}
+
+// addr - Returns the address to listen on
+func (c *config) addr() string {
+	return c.Host + ":" + strconv.Itoa(c.Port)
+}
+
+// moderators - Returns the set of moderator handles
+func (c *config) moderators() map[string]bool {
+	moderators := make(map[string]bool)
+	for _, handle := range strings.Split(c.Moderators, ",") {
+		if handle = strings.TrimSpace(handle); handle != "" {
+			moderators[handle] = true
+		}
+	}
+	return moderators
+}
+
+// envName - Returns the environment variable for the option called name
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func stringOption(name string, usage string, target *string) option {
+	return option{
+		name:  name,
+		usage: usage,
+		set: func(value string) error {
+			*target = value
+			return nil
+		},
+		value: func() string { return *target },
+	}
+}
+
+func intOption(name string, usage string, target *int) option {
+	return option{
+		name:  name,
+		usage: usage,
+		set: func(value string) error {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			*target = parsed
+			return nil
+		},
+		value: func() string { return strconv.Itoa(*target) },
+	}
+}
+
+func boolOption(name string, usage string, target *bool) option {
+	return option{
+		name:  name,
+		usage: usage,
+		set: func(value string) error {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			*target = parsed
+			return nil
+		},
+		value:  func() string { return strconv.FormatBool(*target) },
+		isBool: true,
+	}
+}
+
+func durationOption(name string, usage string, target *duration) option {
+	return option{
+		name:  name,
+		usage: usage,
+		set: func(value string) error {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			*target = duration(parsed)
+			return nil
+		},
+		value: func() string { return time.Duration(*target).String() },
+	}
+}
+
+// recordedFlag - flag.Value that records the raw value so it can be applied after the config file and environment
+type recordedFlag struct {
+	name     string
+	value    string
+	isBool   bool
+	provided map[string]string
+}
+
+// String - Returns the default shown in usage
+func (f *recordedFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+// Set - Record the value provided on the command line
+func (f *recordedFlag) Set(value string) error {
+	f.provided[f.name] = value
+	return nil
+}
+
+// IsBoolFlag - Allows boolean options to be passed without a value
+func (f *recordedFlag) IsBoolFlag() bool {
+	return f.isBool
+}
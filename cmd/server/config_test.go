@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestValidateRejectsInvalidSettings - Each invalid setting is refused at startup while the defaults are accepted
+func TestValidateRejectsInvalidSettings(t *testing.T) {
+	if err := defaultConfig().validate(); err != nil {
+		t.Fatalf("Default settings fail validation: %v", err)
+	}
+	cases := map[string]func(c *config){
+		"unknown user store":    func(c *config) { c.Store = "mysql" },
+		"empty user store":      func(c *config) { c.Store = "" },
+		"unknown message store": func(c *config) { c.MessageStore = "sqlite" },
+		"port":                  func(c *config) { c.Port = 0 },
+		"path":                  func(c *config) { c.Path = "chat" },
+		"queue policy":          func(c *config) { c.QueuePolicy = "block" },
+		"max message":           func(c *config) { c.Limits.MaxMessage = 0 },
+		"max emoji":             func(c *config) { c.Limits.MaxEmoji = 0 },
+		"max reactions":         func(c *config) { c.Limits.MaxReactions = 0 },
+	}
+	for name, breakConfig := range cases {
+		c := defaultConfig()
+		breakConfig(c)
+		if err := c.validate(); err == nil {
+			t.Errorf("%s: invalid setting passed validation", name)
+		}
+	}
+	for _, store := range []string{"file", "memory", "sqlite"} {
+		c := defaultConfig()
+		c.Store = store
+		if err := c.validate(); err != nil {
+			t.Errorf("User store %s fails validation: %v", store, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "unicode"
+
+// emojiBases - Code points that are emoji on their own
+// Covers the pictographic blocks of Unicode 15 and the older symbols commonly shown as emoji
+var emojiBases = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x23ff, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x303d, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1f0ff, Stride: 1},
+		{Lo: 0x1f10d, Hi: 0x1f1ff, Stride: 1},
+		{Lo: 0x1f200, Hi: 0x1f2ff, Stride: 1},
+		{Lo: 0x1f300, Hi: 0x1f5ff, Stride: 1},
+		{Lo: 0x1f600, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f680, Hi: 0x1f6ff, Stride: 1},
+		{Lo: 0x1f700, Hi: 0x1f7ff, Stride: 1},
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x1fa70, Hi: 0x1faff, Stride: 1},
+	},
+	LatinOffset: 1,
+}
+
+// emojiModifiers - Code points that only combine with an emoji base
+// Zero width joiner, the keycap, variation selectors and the tags used by subdivision flags
+// Skin tones are in the pictographic block above and may also stand alone
+var emojiModifiers = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1},
+		{Lo: 0x20e3, Hi: 0x20e3, Stride: 1},
+		{Lo: 0xfe0e, Hi: 0xfe0f, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+	},
+}
+
+// keycapBase - Evaluates if r can start a keycap emoji such as 1️⃣
+func keycapBase(r rune) bool {
+	return r >= '0' && r <= '9' || r == '#' || r == '*'
+}
+
+// isEmoji - Evaluates if text is made of emoji code points only
+// Sequences such as flags, skin tones and ZWJ families are accepted as one emoji, but text, spaces and control characters are not
+func isEmoji(text string) bool {
+	bases := 0
+	keycap := false
+	for i, r := range text {
+		switch {
+		case unicode.Is(emojiBases, r):
+			bases++
+		case unicode.Is(emojiModifiers, r):
+			if i == 0 {
+				return false
+			}
+			keycap = keycap || r == 0x20e3
+		case keycapBase(r) && i == 0:
+			bases++
+		default:
+			return false
+		}
+	}
+	if bases == 0 {
+		return false
+	}
+	// A digit, # or * is only an emoji as a keycap
+	first := []rune(text)[0]
+	return !keycapBase(first) || keycap
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestIsEmoji - Single emoji and emoji sequences are accepted, text and padding are not
+func TestIsEmoji(t *testing.T) {
+	cases := []struct {
+		text string
+		want bool
+	}{
+		{"👍", true},
+		{"👍🏽", true},
+		{"❤️", true},
+		{"🇳🇿", true},
+		{"1️⃣", true},
+		{"#️⃣", true},
+		{"👩‍👩‍👧", true},
+		{"🏴󠁧󠁢󠁳󠁣󠁴󠁿", true},
+		{"", false},
+		{"a", false},
+		{"1", false},
+		{"👍a", false},
+		{"a👍", false},
+		{"👍 ", false},
+		{"‍👍", false},
+		{"️", false},
+		{"👍\u0000", false},
+		{"<b>", false},
+	}
+	for _, c := range cases {
+		if got := isEmoji(c.text); got != c.want {
+			t.Errorf("isEmoji(%q) = %t, want %t", c.text, got, c.want)
+		}
+	}
+}
@@ -1,106 +1,322 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/masonflint44/websocketLab/pkg/interfaces"
 	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+	"github.com/masonflint44/websocketLab/pkg/search"
+	"github.com/masonflint44/websocketLab/pkg/stores"
+	_ "modernc.org/sqlite"
 )
 
+// helloTimeout - Time a new connection has to send its hello frame
+const helloTimeout = 10 * time.Second
+
+// defaultHistory - Messages returned by history without a count
+const defaultHistory = 20
+
+// serverHandle - Name the server signs its notices with, which no user may register
+const serverHandle = "Server"
+
+// quoteLen - Characters of the parent message quoted by a reply
+const quoteLen = 80
+
 var upgrader = websocket.Upgrader{}
-var clients = make(map[*websocket.Conn]interfaces.Client)
+var clients = newClientRegistry()
+var users interfaces.UserStore
+var sessions interfaces.SessionStore
+var messages interfaces.MessageStore
+var index = search.NewIndex()
+var limiter *rateLimiter
+
+var commands = newCommandRegistry()
+var rooms = newRoomRegistry()
+var writers *writerRegistry
 
-var loginRequests = make(chan request)
-var newUserRequests = make(chan request)
-var sendRequests = make(chan request)
-var logoutRequests = make(chan request)
-var helpRequests = make(chan request)
-var outboundResponses = make(chan interfaces.Message)
+var failedUpgrades = expvar.NewInt("failed_upgrades")
 
 func main() {
-	defer func() {
-		log.Println("Disconnecting all clients...")
-		for conn := range clients {
-			disconnect(conn)
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	users, err = openUserStore(cfg.Store, cfg.Users)
+	if err != nil {
+		log.Fatal(err)
+	}
+	messages, err = openMessageStore(cfg.MessageStore, cfg.Messages)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := indexMessages(); err != nil {
+		log.Fatal(err)
+	}
+	sessions = stores.NewMemorySessionStore(time.Duration(cfg.SessionTTL))
+	limiter, err = newRateLimiter(cfg.RateLimits, cfg.RateStrikes, cfg.LoginHandleLimit, cfg.LoginIPLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := parseOverflowPolicy(cfg.QueuePolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writers = newWriterRegistry(cfg.QueueSize, policy, time.Duration(cfg.PingInterval))
+	origins, err := parseOrigins(cfg.AllowedOrigins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	upgrader.CheckOrigin = checkOrigin(origins, cfg.AllowNoOrigin)
+	tlsConf, err := tlsConfig(cfg.Cert, cfg.Key, cfg.SelfSigned, cfg.SelfSignedHosts, cfg.SelfSignedOut)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc(cfg.Path, wsHandler(time.Duration(cfg.PongTimeout), cfg.Limits.frameLimit()))
+	if err := registerCommands(cfg.Limits, cfg.HistoryReplay, cfg.moderators()); err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{Addr: cfg.addr(), TLSConfig: tlsConf}
+	go func() {
+		var err error
+		if tlsConf != nil {
+			log.Printf("Starting server with TLS on %s... \n", cfg.addr())
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Starting server on %s... \n", cfg.addr())
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
 		}
 	}()
 
-	http.HandleFunc("/", wsHandler)
-	go sendMessages()
-	go processSendRequests()
-	go processLoginRequests()
-	go processNewUserRequests()
-	go processLogoutRequests()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Println("Received", sig, "- shutting down...")
+	shutdown(server, time.Duration(cfg.ShutdownTimeout))
+	log.Println("Server stopped")
+}
 
-	log.Printf("Starting server... \n")
-	err := http.ListenAndServe(":11631", nil)
-	log.Fatal(err)
+// openUserStore - Create the user store backend selected by kind
+func openUserStore(kind string, path string) (interfaces.UserStore, error) {
+	switch kind {
+	case "file":
+		return stores.NewFileUserStore(path), nil
+	case "memory":
+		return stores.NewMemoryUserStore(), nil
+	case "sqlite":
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			return nil, err
+		}
+		return stores.NewSQLUserStore(db)
+	default:
+		return nil, fmt.Errorf("Unknown user store %q", kind)
+	}
 }
 
-// wsHandler - Upgrade connection to websocket connection
-func wsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// openMessageStore - Create the message store backend selected by kind
+func openMessageStore(kind string, path string) (interfaces.MessageStore, error) {
+	switch kind {
+	case "file":
+		return stores.NewFileMessageStore(path)
+	case "memory":
+		return stores.NewMemoryMessageStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown message store %q", kind)
+	}
+}
 
+// indexMessages - Add every recorded message to the search index
+func indexMessages() error {
+	recorded, err := messages.All()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	for _, message := range recorded {
+		index.Add(message)
 	}
+	return nil
+}
 
-	client := &models.Client{Conn: conn}
-	clients[conn] = client
-	go receiveMessages(conn)
+// wsHandler - Upgrade connection to websocket connection
+// Clients that do not answer pings within pongTimeout or send a frame larger than readLimit are disconnected
+func wsHandler(pongTimeout time.Duration, readLimit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isShuttingDown() {
+			http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		// Upgrade has already answered the request with an HTTP error
+		if err != nil {
+			failedUpgrades.Add(1)
+			log.Println("Error: Unable to upgrade connection from", r.RemoteAddr, "-", err)
+			return
+		}
+
+		go receiveMessages(conn, pongTimeout, readLimit)
 
-	outboundResponses <- &models.Message{Body: "Welcome to the chat room!", Client: &models.Client{Handle: "Server", Conn: client.GetConn()}}
+		fmt.Println("Client connected")
+	}
+}
+
+// negotiate - Agree on a protocol version with a newly connected client
+// The client must open with a hello frame listing the versions it speaks
+func negotiate(conn *websocket.Conn) (int, error) {
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var hello protocol.Envelope
+	var payload protocol.HelloPayload
+	err := conn.ReadJSON(&hello)
+	if err == nil && hello.Type != protocol.TypeHello {
+		err = errors.New("Expected hello frame")
+	}
+	if err == nil {
+		err = hello.Decode(&payload)
+	}
+	if err != nil {
+		writeError(conn, protocol.CodeBadFrame, "Connection must start with a hello frame")
+		return 0, err
+	}
+	version, err := protocol.Negotiate(payload.Versions)
+	if err != nil {
+		writeError(conn, protocol.CodeUnsupportedVersion, fmt.Sprintf("Server supports protocol versions %v", protocol.SupportedVersions))
+		return 0, err
+	}
+	return version, nil
+}
 
-	fmt.Println("Client connected")
+// writeError - Write an error frame directly to a connection that has no write pump
+func writeError(conn *websocket.Conn, code string, body string) {
+	frame, err := protocol.NewEnvelope(protocol.TypeError, protocol.ErrorPayload{Code: code, Message: body})
+	if err == nil {
+		err = conn.WriteJSON(frame)
+	}
+	errorPipe(err, printError)
 }
 
 // receiveMessages - Receives messages for each connected client
-func receiveMessages(conn *websocket.Conn) {
+// Every pong or frame from the client extends its read deadline by pongTimeout
+// A frame larger than readLimit closes the connection
+func receiveMessages(conn *websocket.Conn, pongTimeout time.Duration, readLimit int64) {
+	conn.SetReadLimit(readLimit)
+	version, err := negotiate(conn)
+	if err != nil {
+		log.Println("Error: Unable to negotiate protocol version -", err)
+		conn.Close()
+		return
+	}
+
+	client := &models.Client{Conn: conn}
+	writers.start(conn, version)
+	clients.add(client)
 	defer disconnect(conn)
+
+	queueFrameToClient(protocol.TypeWelcome, protocol.WelcomePayload{
+		Version: version,
+		Message: "Welcome to the chat room!",
+	})(client)
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
 	for {
-		var demarshaled struct {
-			Command string
-			Body    string
-			Client  models.Client
+		var frame protocol.Envelope
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		err := conn.ReadJSON(&frame)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			idleDisconnects.Add(1)
+			log.Println("Client", conn.RemoteAddr(), "stopped answering pings")
+			log.Println("Disconnecting client...")
+			break
 		}
-		err := conn.ReadJSON(&demarshaled)
 		if err != nil {
 			log.Println("Error: Unable to read message from client")
 			log.Println("Disconnecting client...")
 			break
 		}
-		message := &models.Message{
-			Command: demarshaled.Command,
-			Body:    demarshaled.Body,
-			Client:  &demarshaled.Client,
+		client, ok := clients.get(conn)
+		if !ok {
+			log.Println("Error: Received message from unregistered connection")
+			break
+		}
+		if frame.Version != version {
+			queueErrorToClient(protocol.CodeBadFrame, fmt.Sprintf("Expected protocol version %d", version))(client)
+			continue
+		}
+		payload, ok := protocol.NewCommandPayload(frame.Type)
+		if !ok {
+			// Unknown commands are rejected by dispatch once they pass the rate limit
+			dispatch(client, frame.Type, nil)
+			continue
 		}
-		request := serverRequest{
-			Message: message,
-			Client:  models.CloneClient(clients[conn]),
+		if err := frame.Decode(payload); err != nil {
+			queueErrorToClient(protocol.CodeBadFrame, "Payload does not match the "+frame.Type+" command")(client)
+			continue
 		}
+		dispatch(client, frame.Type, payload.Args())
+	}
+}
 
-		switch command := message.GetCommand(); command {
-		case "login":
-			loginRequests <- request
-		case "newuser":
-			newUserRequests <- request
-		case "send":
-			sendRequests <- request
-		case "logout":
-			logoutRequests <- request
-		case "help":
-			helpRequests <- request
-		default:
-			log.Println("Received unrecognized command -", command, "- from client")
+// dispatch - Validate args against the command called name and pass them to the command's handler
+func dispatch(client interfaces.Client, name string, args map[string]string) {
+	if !throttle(client, name) {
+		return
+	}
+	cmd, ok := commands.lookup(name)
+	if !ok {
+		log.Println("Received unrecognized command -", name, "- from client")
+		queueErrorToClient(protocol.CodeUnknownCommand, "Unknown command '"+name+"' - Type 'help' to get a list of available commands")(client)
+		return
+	}
+	touchSession(client)
+	if err := protocol.ValidateArgs(name, args); err != nil {
+		queueErrorToClient(protocol.CodeInvalidArgument, err.Error())(client)
+		return
+	}
+	if cmd.Auth {
+		_, err := clientPipe(client, nil,
+			onClientError(
+				hasAuth,
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeUnauthorized, "Unauthorized - Please login")),
+			),
+		)
+		if err != nil {
+			return
 		}
 	}
+	cmd.Handler(serverRequest{
+		Client: client,
+		Args:   args,
+	})
 }
 
 // disconnect - Close provided connection
 func disconnect(conn *websocket.Conn) {
 	conn.Close()
-	delete(clients, conn)
+	writers.stop(conn)
+	if client, ok := clients.get(conn); ok {
+		leaveAllRooms(client)
+		touchSession(client)
+	}
+	clients.remove(conn)
 }
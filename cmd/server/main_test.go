@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+	"github.com/masonflint44/websocketLab/pkg/search"
+	"github.com/masonflint44/websocketLab/pkg/stores"
+)
+
+// testTimeout - Time a test client waits for an expected frame
+const testTimeout = 5 * time.Second
+
+// newTestServer - Reset the server's state to in-memory stores and serve wsHandler until the test ends
+// Rate limits are raised so tests can connect and log in many clients from one address
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	cfg := defaultConfig()
+	users = stores.NewMemoryUserStore()
+	messages = stores.NewMemoryMessageStore()
+	sessions = stores.NewMemorySessionStore(time.Duration(cfg.SessionTTL))
+	index = search.NewIndex()
+	clients = newClientRegistry()
+	rooms = newRoomRegistry()
+	commands = newCommandRegistry()
+	writers = newWriterRegistry(4096, dropOldest, time.Duration(cfg.PingInterval))
+	var err error
+	limiter, err = newRateLimiter("*=1000/1000", 1000, "1000/1000", "1000/1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerCommands(cfg.Limits, cfg.HistoryReplay, nil); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(wsHandler(time.Duration(cfg.PongTimeout), cfg.Limits.frameLimit()))
+	t.Cleanup(func() {
+		closeTestConnections(t)
+		server.Close()
+	})
+	return server
+}
+
+// closeTestConnections - Close every connection and wait for each to be disconnected
+// The next test replaces the server's state, so no connection may still be using it
+func closeTestConnections(t *testing.T) {
+	for _, client := range clients.snapshot() {
+		client.GetConn().Close()
+	}
+	deadline := time.Now().Add(testTimeout)
+	for len(clients.snapshot()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Connections were not disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testClient - Test side of a connection to the test server
+// Its methods return errors rather than failing the test so they can be used from several goroutines
+type testClient struct {
+	conn *websocket.Conn
+	// raw - Every frame received, exactly as the server wrote it
+	raw [][]byte
+}
+
+// must - Fail the test if err is set
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dialTestServer - Connect to server and complete the hello handshake
+func dialTestServer(server *httptest.Server) (*testClient, error) {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect - %v", err)
+	}
+	client := &testClient{conn: conn}
+	if err := client.sendFrame(protocol.TypeHello, protocol.HelloPayload{Versions: protocol.SupportedVersions}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := client.expect(protocol.TypeWelcome); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// close - Close the connection
+func (c *testClient) close() {
+	c.conn.Close()
+}
+
+// sendFrame - Send a frame of the provided type and payload
+func (c *testClient) sendFrame(frameType string, payload interface{}) error {
+	frame, err := protocol.NewEnvelope(frameType, payload)
+	if err == nil {
+		err = c.conn.WriteJSON(frame)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to send %s frame - %v", frameType, err)
+	}
+	return nil
+}
+
+// send - Send a line of user input such as "join lobby"
+func (c *testClient) send(line string) error {
+	frame, err := protocol.ParseLine(line)
+	if err == nil {
+		err = c.conn.WriteJSON(frame)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to send %q - %v", line, err)
+	}
+	return nil
+}
+
+// expect - Read frames until one of frameType arrives
+// An error frame ends the wait unless errors are expected
+func (c *testClient) expect(frameType string) (protocol.Envelope, error) {
+	for {
+		var frame protocol.Envelope
+		c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return frame, fmt.Errorf("Expected %s frame - %v", frameType, err)
+		}
+		c.raw = append(c.raw, data)
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return frame, err
+		}
+		if frame.Type == frameType {
+			return frame, nil
+		}
+		if frame.Type == protocol.TypeError {
+			return frame, fmt.Errorf("Expected %s frame - Received error %s", frameType, data)
+		}
+	}
+}
+
+// expectNotice - Read frames until a notice containing text arrives
+func (c *testClient) expectNotice(text string) error {
+	for {
+		frame, err := c.expect(protocol.TypeNotice)
+		if err != nil {
+			return fmt.Errorf("Expected notice %q - %v", text, err)
+		}
+		var notice protocol.NoticePayload
+		if err := frame.Decode(&notice); err != nil {
+			return err
+		}
+		if strings.Contains(notice.Message, text) {
+			return nil
+		}
+	}
+}
+
+// register - Register handle with pass and log in as it
+func (c *testClient) register(handle string, pass string) error {
+	if err := c.send("newuser " + handle + " " + pass); err != nil {
+		return err
+	}
+	if err := c.expectNotice("Welcome!"); err != nil {
+		return err
+	}
+	if err := c.send("login " + handle + " " + pass); err != nil {
+		return err
+	}
+	_, err := c.expect(protocol.TypeSession)
+	return err
+}
+
+// joinAs - Connect, register and log in as handle, then join room
+func joinAs(server *httptest.Server, handle string, room string) (*testClient, error) {
+	client, err := dialTestServer(server)
+	if err != nil {
+		return nil, err
+	}
+	err = client.register(handle, "secret")
+	if err == nil {
+		err = client.send("join " + room)
+	}
+	if err == nil {
+		err = client.expectNotice("Now talking in " + room)
+	}
+	if err != nil {
+		client.close()
+		return nil, fmt.Errorf("%s unable to join %s - %v", handle, room, err)
+	}
+	return client, nil
+}
+
+// TestPlainRequestKeepsServerRunning - A request that is not a WebSocket upgrade is refused without stopping the server
+func TestPlainRequestKeepsServerRunning(t *testing.T) {
+	server := newTestServer(t)
+	before := failedUpgrades.Value()
+
+	response, err := http.Get(server.URL)
+	must(t, err)
+	response.Body.Close()
+	if response.StatusCode < 400 || response.StatusCode >= 500 {
+		t.Errorf("Plain GET returned status %d, want 4xx", response.StatusCode)
+	}
+	if after := failedUpgrades.Value(); after != before+1 {
+		t.Errorf("failed_upgrades went from %d to %d, want %d", before, after, before+1)
+	}
+
+	client, err := dialTestServer(server)
+	must(t, err)
+	defer client.close()
+	must(t, client.register("beth", "secret"))
+}
+
+// TestOversizedMessagesAreRefused - Messages longer than the limit are rejected and frames beyond the read limit close the connection
+func TestOversizedMessagesAreRefused(t *testing.T) {
+	server := newTestServer(t)
+	limit := defaultConfig().Limits.MaxMessage
+	beth, err := joinAs(server, "beth", "lobby")
+	must(t, err)
+	defer beth.close()
+	pat, err := joinAs(server, "pat", "lobby")
+	must(t, err)
+	defer pat.close()
+
+	must(t, beth.send("send hello"))
+	_, err = beth.expect(protocol.TypeChat)
+	must(t, err)
+	long := strings.Repeat("x", limit+1)
+	for _, line := range []string{"send " + long, "msg pat " + long, "edit 1 " + long, "reply 1 " + long} {
+		must(t, beth.send(line))
+		frame, err := beth.expect(protocol.TypeError)
+		must(t, err)
+		var failure protocol.ErrorPayload
+		must(t, frame.Decode(&failure))
+		if failure.Code != protocol.CodeInvalidArgument {
+			t.Errorf("%s failed with %s, want %s", strings.Fields(line)[0], failure.Code, protocol.CodeInvalidArgument)
+		}
+	}
+	if recorded, err := messages.Get("2"); err == nil {
+		t.Errorf("Oversized message was recorded: %d bytes", len(recorded.Message))
+	}
+
+	must(t, beth.sendFrame("send", map[string]string{"message": strings.Repeat("x", int(defaultConfig().Limits.frameLimit()))}))
+	if _, err := beth.expect(protocol.TypeChat); err == nil {
+		t.Error("Connection stayed open after a frame beyond the read limit")
+	}
+	must(t, pat.send("send still here"))
+	for {
+		frame, err := pat.expect(protocol.TypeChat)
+		must(t, err)
+		var chat protocol.ChatPayload
+		must(t, frame.Decode(&chat))
+		if chat.Message == "still here" {
+			break
+		}
+	}
+}
+
+// TestMistypedPayloadIsRefused - A payload that does not fit its command's typed payload is answered with bad_frame
+func TestMistypedPayloadIsRefused(t *testing.T) {
+	server := newTestServer(t)
+	client, err := joinAs(server, "beth", "lobby")
+	must(t, err)
+	defer client.close()
+
+	must(t, client.sendFrame("history", map[string]int{"count": 5}))
+	frame, err := client.expect(protocol.TypeError)
+	must(t, err)
+	var failure protocol.ErrorPayload
+	must(t, frame.Decode(&failure))
+	if failure.Code != protocol.CodeBadFrame {
+		t.Errorf("history with a numeric count failed with %s, want %s", failure.Code, protocol.CodeBadFrame)
+	}
+	must(t, client.sendFrame("send", protocol.SendPayload{Message: "typed"}))
+	_, err = client.expect(protocol.TypeChat)
+	must(t, err)
+}
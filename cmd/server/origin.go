@@ -0,0 +1,108 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var rejectedOrigins = expvar.NewInt("rejected_origins")
+
+// originPattern - An allowed origin such as https://chat.example.com or https://*.example.com
+// An empty scheme matches any scheme, an empty port matches any port and a host starting with *. matches any subdomain of the rest
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+// parseOrigins - Parse a comma separated list of allowed origins
+func parseOrigins(list string) ([]originPattern, error) {
+	var patterns []originPattern
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		var pattern originPattern
+		host := entry
+		if i := strings.Index(entry, "://"); i >= 0 {
+			pattern.scheme = entry[:i]
+			host = entry[i+3:]
+		}
+		if h, port, err := net.SplitHostPort(host); err == nil {
+			host, pattern.port = h, port
+		}
+		if strings.HasPrefix(host, "*.") {
+			pattern.wildcard = true
+			host = host[2:]
+		}
+		if host == "" || strings.HasPrefix(host, ".") || strings.ContainsAny(host, "/*:") {
+			return nil, fmt.Errorf("Invalid allowed origin %q", entry)
+		}
+		pattern.host = host
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// matches - Reports whether origin is accepted by the pattern
+// Hosts are compared without their port, and a wildcard only matches whole labels so evilexample.com is not a subdomain of example.com
+func (p originPattern) matches(origin *url.URL) bool {
+	if p.scheme != "" && p.scheme != strings.ToLower(origin.Scheme) {
+		return false
+	}
+	if p.port != "" && p.port != origin.Port() {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(origin.Hostname()), ".")
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// checkOrigin - Returns an Upgrader.CheckOrigin accepting the allowed origins
+// Without allowed origins only same-origin requests are accepted
+// Requests without an Origin header come from native clients and are accepted if allowMissing is set
+func checkOrigin(allowed []originPattern, allowMissing bool) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		header := r.Header.Get("Origin")
+		if header == "" {
+			if !allowMissing {
+				rejectOrigin(r, "missing Origin header")
+			}
+			return allowMissing
+		}
+		origin, err := url.Parse(header)
+		if err != nil || origin.Host == "" {
+			rejectOrigin(r, "malformed Origin "+header)
+			return false
+		}
+		if len(allowed) == 0 {
+			if strings.EqualFold(origin.Host, r.Host) {
+				return true
+			}
+			rejectOrigin(r, "cross-origin request from "+header)
+			return false
+		}
+		for _, pattern := range allowed {
+			if pattern.matches(origin) {
+				return true
+			}
+		}
+		rejectOrigin(r, "origin "+header+" is not allowed")
+		return false
+	}
+}
+
+// rejectOrigin - Log and count an upgrade refused because of its origin
+func rejectOrigin(r *http.Request, reason string) {
+	rejectedOrigins.Add(1)
+	log.Println("Rejected connection from", r.RemoteAddr, "-", reason)
+}
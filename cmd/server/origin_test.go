@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestCheckOriginMatchesHostsAndPorts - Patterns match the origin's hostname whatever its port, and wildcards match whole labels only
+func TestCheckOriginMatchesHostsAndPorts(t *testing.T) {
+	allowed, err := parseOrigins("https://chat.example.com, https://*.example.org, http://localhost:8080")
+	must(t, err)
+	check := checkOrigin(allowed, false)
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://chat.example.com", true},
+		{"https://chat.example.com:8443", true},
+		{"https://CHAT.example.com", true},
+		{"http://chat.example.com", false},
+		{"https://chat.example.com.evil.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org:443", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"https://a.evilexample.org", false},
+		{"https://example.org.evil.com", false},
+		{"http://localhost:8080", true},
+		{"http://localhost:9090", false},
+		{"http://localhost", false},
+	}
+	for _, c := range cases {
+		r, err := http.NewRequest("GET", "http://server/", nil)
+		must(t, err)
+		r.Header.Set("Origin", c.origin)
+		if got := check(r); got != c.want {
+			t.Errorf("checkOrigin(%s) = %t, want %t", c.origin, got, c.want)
+		}
+	}
+}
+
+// TestParseOriginsRejectsInvalidPatterns - Patterns with paths or misplaced wildcards are refused at startup
+func TestParseOriginsRejectsInvalidPatterns(t *testing.T) {
+	for _, list := range []string{"*.", "https://*", "https://a.*.example.com", "https://example.com/path"} {
+		if _, err := parseOrigins(list); err == nil {
+			t.Errorf("parseOrigins(%q) accepted an invalid pattern", list)
+		}
+	}
+}
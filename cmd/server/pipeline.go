@@ -1,15 +1,18 @@
 package main
 
 import (
-	"bufio"
 	"errors"
-	"io"
+	"fmt"
 	"log"
-	"os"
+	"strings"
+	"time"
 
-	"github.com/masonflint44/websocketLab/pkg/helpers"
+	"github.com/gorilla/websocket"
 	"github.com/masonflint44/websocketLab/pkg/interfaces"
 	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+	"github.com/masonflint44/websocketLab/pkg/search"
+	"github.com/masonflint44/websocketLab/pkg/stores"
 )
 
 // TODO: update documentation
@@ -85,12 +88,6 @@ func setClient(client interfaces.Client) func(message interfaces.Message) (inter
 	}
 }
 
-// sendMessage - Send message to client
-func sendMessage(message interfaces.Message) (interfaces.Message, error) {
-	err := message.GetClient().GetConn().WriteJSON(message)
-	return message, err
-}
-
 func clientProcessorToErrorHandler(processor func(interfaces.Client) (interfaces.Client, error)) func(interfaces.Client, error) (interfaces.Client, error) {
 	return func(client interfaces.Client, err error) (interfaces.Client, error) {
 		nextClient, err := processor(client)
@@ -114,6 +111,21 @@ func onClientError(processor func(interfaces.Client) (interfaces.Client, error),
 	}
 }
 
+// onMatchingError - Error handler applying processor only to errors matching target
+// A matching error stops the handlers after it from running, so a final handler can cover every other error
+func onMatchingError(target error, processor func(interfaces.Client) (interfaces.Client, error)) func(interfaces.Client, error) (interfaces.Client, error) {
+	return func(client interfaces.Client, err error) (interfaces.Client, error) {
+		if !errors.Is(err, target) {
+			return client, nil
+		}
+		nextClient, handlerErr := processor(client)
+		if handlerErr != nil {
+			return nextClient, handlerErr
+		}
+		return nextClient, err
+	}
+}
+
 func catchClientError(processor func(interfaces.Client) (interfaces.Client, error), handlers ...func(interfaces.Client, error) (interfaces.Client, error)) func(interfaces.Client) (interfaces.Client, error) {
 	return func(client interfaces.Client) (interfaces.Client, error) {
 		nextClient, err := processor(client)
@@ -140,20 +152,14 @@ func queueMessageToClient(message interfaces.Message) func(interfaces.Client) (i
 }
 
 func queueCustomMessageToClient(handle string, body string) func(interfaces.Client) (interfaces.Client, error) {
-	return func(client interfaces.Client) (interfaces.Client, error) {
-		client.SetHandle(handle)
-		_, err := messagePipe(&models.Message{Body: body, Client: client}, nil, queueMessage)
-		return client, err
-	}
+	return queueCustomRoomMessageToClient(handle, "", body)
 }
 
-func sendMessageToClient(message interfaces.Message) func(interfaces.Client) (interfaces.Client, error) {
+// queueCustomRoomMessageToClient - Queue a message about room to the client
+func queueCustomRoomMessageToClient(handle string, room string, body string) func(interfaces.Client) (interfaces.Client, error) {
 	return func(client interfaces.Client) (interfaces.Client, error) {
-		_, err := messagePipe(message, nil,
-			hasMessage,
-			setClient(client),
-			sendMessage,
-		)
+		client.SetHandle(handle)
+		_, err := messagePipe(&models.Message{Command: protocol.TypeNotice, Body: body, Client: client, Room: room}, nil, queueMessage)
 		return client, err
 	}
 }
@@ -181,23 +187,41 @@ func hasAuth(client interfaces.Client) (interfaces.Client, error) {
 	return client, nil
 }
 
-// validHandle - Evaluates if client has a valid handle
-func validHandle(client interfaces.Client) (interfaces.Client, error) {
-	if len(client.GetHandle()) > 32 {
-		return client, errors.New("Handle must be less than 32 characters")
+// validHandle - Evaluates if client has a handle of at most max letters, digits, '_' or '-'
+func validHandle(max int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if len(client.GetHandle()) > max || !protocol.ValidHandle(client.GetHandle()) {
+			return client, fmt.Errorf("Handle must be 1 to %d letters, digits, '_' or '-'", max)
+		}
+		return client, nil
+	}
+}
+
+// unreservedHandle - Fails if client's handle could be mistaken for the server, ignoring case and surrounding space
+func unreservedHandle(client interfaces.Client) (interfaces.Client, error) {
+	if strings.EqualFold(strings.TrimSpace(client.GetHandle()), serverHandle) {
+		return client, errors.New("Handle " + client.GetHandle() + " is reserved")
 	}
 	return client, nil
 }
 
-// validPass - Ensures client has a valid password
-func validPass(client interfaces.Client) (interfaces.Client, error) {
-	length := len(client.GetPass())
-	if length < 4 || length > 8 {
-		return client, errors.New("Pass must be between 4 and 8 characters")
-	}
+// forgetPass - Clear the password once it is no longer needed
+func forgetPass(client interfaces.Client) (interfaces.Client, error) {
+	client.SetPass("")
 	return client, nil
 }
 
+// validPass - Ensures client has a password of between min and max characters
+func validPass(min int, max int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		length := len(client.GetPass())
+		if length < min || length > max {
+			return client, fmt.Errorf("Pass must be between %d and %d characters", min, max)
+		}
+		return client, nil
+	}
+}
+
 func setHandle(source interfaces.Client) func(client interfaces.Client) (interfaces.Client, error) {
 	return func(target interfaces.Client) (interfaces.Client, error) {
 		target.SetHandle(source.GetHandle())
@@ -214,91 +238,121 @@ func setConn(source interfaces.Client) func(client interfaces.Client) (interface
 
 // logout - Log out provided client
 func logout(client interfaces.Client) (interfaces.Client, error) {
-	clients[client.GetConn()] = &models.Client{Conn: client.GetConn()}
+	clients.add(&models.Client{Conn: client.GetConn()})
 	return client, nil
 }
 
-// queueMessage - Push message to outbound queue
+// queueMessage - Push the frame delivering message to the outbound queue of the client it is addressed to
 func queueMessage(message interfaces.Message) (interfaces.Message, error) {
-	outboundResponses <- message
-	return message, nil
+	client := message.GetClient()
+	if client == nil {
+		return message, errors.New("Message has no recipient")
+	}
+	frame, err := frameFromMessage(message)
+	if err != nil {
+		return message, err
+	}
+	err = queueFrame(client.GetConn(), frame)
+	return message, err
 }
 
-// register - Register client as a new user
-func register(client interfaces.Client) (interfaces.Client, error) {
-	file, err := os.OpenFile("users.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.ModeAppend)
-	if err != nil {
-		return client, err
+// queueFrame - Push frame to the outbound queue of conn
+func queueFrame(conn *websocket.Conn, frame protocol.Envelope) error {
+	pump, ok := writers.get(conn)
+	if !ok {
+		return errors.New("Client is not connected")
 	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
-	_, err = writer.WriteString("\n" + client.GetHandle() + "," + client.GetPass())
-	if err != nil {
+	return pump.enqueue(frame)
+}
+
+// frameFromMessage - Build the frame delivering message to its recipient
+// Messages the server built as notices become notice frames, everything else is chat
+// Only the sender's handle is copied from the attached client, never its credentials or connection
+func frameFromMessage(message interfaces.Message) (protocol.Envelope, error) {
+	handle := message.GetClient().GetHandle()
+	if message.GetCommand() == protocol.TypeNotice {
+		return protocol.NewEnvelope(protocol.TypeNotice, protocol.NoticePayload{
+			Room:    message.GetRoom(),
+			Message: message.GetBody(),
+		})
+	}
+	return protocol.NewEnvelope(protocol.TypeChat, chatFromMessage(handle, message))
+}
+
+// chatFromMessage - Build the chat payload for a message sent by handle
+// Messages that were not recorded are stamped with the current time
+func chatFromMessage(handle string, message interfaces.Message) protocol.ChatPayload {
+	sent := message.GetSent()
+	if sent.IsZero() {
+		sent = time.Now().UTC()
+	}
+	return protocol.ChatPayload{
+		ID:      message.GetID(),
+		From:    handle,
+		Room:    message.GetRoom(),
+		To:      message.GetRecipient(),
+		Message: message.GetBody(),
+		Sent:    sent,
+	}
+}
+
+// queueFrameToClient - Queue a frame of the provided type and payload to the client
+func queueFrameToClient(frameType string, payload interface{}) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		frame, err := protocol.NewEnvelope(frameType, payload)
+		if err != nil {
+			return client, err
+		}
+		err = queueFrame(client.GetConn(), frame)
 		return client, err
 	}
+}
+
+// queueErrorToClient - Queue an error frame to the client
+func queueErrorToClient(code string, body string) func(interfaces.Client) (interfaces.Client, error) {
+	return queueFrameToClient(protocol.TypeError, protocol.ErrorPayload{Code: code, Message: body})
+}
+
+// register - Register client as a new user
+func register(client interfaces.Client) (interfaces.Client, error) {
+	err := users.Create(client.GetHandle(), client.GetPass())
 	return client, err
 }
 
 // uniqueHandle - Ensures client has a unique handle
 func uniqueHandle(client interfaces.Client) (interfaces.Client, error) {
-	file, err := os.Open("users.txt")
+	exists, err := users.Lookup(client.GetHandle())
 	if err != nil {
 		return client, err
 	}
-	defer file.Close()
-	reader := bufio.NewReader(file)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return client, err
-		}
-		handle, _ := helpers.SplitOnFirstDelim(',', line)
-		if client.GetHandle() == handle {
-			return client, errors.New("Handle is not unique")
-		}
-		if err == io.EOF {
-			break
-		}
+	if exists {
+		return client, stores.ErrHandleTaken
 	}
-	return client, err
+	return client, nil
 }
 
 // authorize - Log in existing user
 func authorize(messageClient interfaces.Client) func(interfaces.Client) (interfaces.Client, error) {
 	return func(requestClient interfaces.Client) (interfaces.Client, error) {
-		file, err := os.Open("users.txt")
+		ok, err := users.Verify(messageClient.GetHandle(), messageClient.GetPass())
 		if err != nil {
-			// Unable to open login credentials source
+			// Unable to read from login credentials source
 			return requestClient, err
 		}
-		defer file.Close()
-		reader := bufio.NewReader(file)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil && err != io.EOF {
-				// Unable to read from login credentials source
-				return requestClient, err
-			}
-			handle, pass := helpers.SplitOnFirstDelim(',', line)
-			if messageClient.GetHandle() == handle && messageClient.GetPass() == pass {
-				clients[requestClient.GetConn()] = &models.Client{
-					Conn:   requestClient.GetConn(),
-					Handle: handle,
-				}
-				return requestClient, nil
-			}
-			if err == io.EOF {
-				break
-			}
+		if !ok {
+			return requestClient, errors.New("Login credentials not in store")
 		}
-		return requestClient, errors.New("Login credentials not in file")
+		clients.add(&models.Client{
+			Conn:   requestClient.GetConn(),
+			Handle: messageClient.GetHandle(),
+		})
+		return requestClient, nil
 	}
 }
 
 // forEachClient - Perform provided function for each client on server
 func forEachClient(err error, processors ...func(interfaces.Client) (interfaces.Client, error)) error {
-	for _, client := range clients {
+	for _, client := range clients.snapshot() {
 		if err != nil {
 			return err
 		}
@@ -306,3 +360,466 @@ func forEachClient(err error, processors ...func(interfaces.Client) (interfaces.
 	}
 	return err
 }
+
+// forEachRoomMember - Perform provided function for each client in room
+// A member the processors fail for is logged and skipped so the rest of the room is still visited
+func forEachRoomMember(room string, err error, processors ...func(interfaces.Client) (interfaces.Client, error)) error {
+	if err != nil {
+		return err
+	}
+	for _, conn := range rooms.memberConns(room) {
+		client, ok := clients.get(conn)
+		if !ok {
+			continue
+		}
+		deliver(client, processors...)
+	}
+	return nil
+}
+
+// forEachSession - Perform provided function for each connection authenticated as one of handles
+// Connections are visited once even if a handle is repeated
+// A connection the processors fail for is logged and skipped so the remaining connections are still visited
+func forEachSession(handles []string, err error, processors ...func(interfaces.Client) (interfaces.Client, error)) error {
+	if err != nil {
+		return err
+	}
+	visited := make(map[*websocket.Conn]bool)
+	for _, handle := range handles {
+		for _, client := range clients.findByHandle(handle) {
+			if visited[client.GetConn()] {
+				continue
+			}
+			visited[client.GetConn()] = true
+			deliver(client, processors...)
+		}
+	}
+	return nil
+}
+
+// deliver - Apply processors to one recipient of a broadcast, logging rather than returning any error
+// Recipients that are disconnecting, stopped or dropped for a full queue must not cut the broadcast short
+func deliver(client interfaces.Client, processors ...func(interfaces.Client) (interfaces.Client, error)) {
+	_, err := clientPipe(client, nil, processors...)
+	if err != nil {
+		log.Println("Unable to deliver to", client.GetConn().RemoteAddr(), "-", err)
+	}
+}
+
+// online - Evaluates if any client is authenticated as handle
+func online(handle string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if len(clients.findByHandle(handle)) == 0 {
+			return client, errors.New("Recipient is not online")
+		}
+		return client, nil
+	}
+}
+
+// registered - Evaluates if handle belongs to a registered user
+func registered(handle string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		exists, err := users.Lookup(handle)
+		if err != nil {
+			return client, err
+		}
+		if !exists {
+			return client, errors.New("Recipient is not registered")
+		}
+		return client, nil
+	}
+}
+
+// queueRoomNotice - Queue a server message to every client in room
+func queueRoomNotice(room string, body string) error {
+	return forEachRoomMember(room, nil,
+		setHandle(&models.Client{Handle: serverHandle}),
+		queueMessageToClient(&models.Message{Command: protocol.TypeNotice, Body: body, Room: room}),
+	)
+}
+
+// validRoom - Evaluates if room is a valid room name of at most max characters
+func validRoom(room string, max int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if len(room) > max {
+			return client, fmt.Errorf("Room name must be less than %d characters", max)
+		}
+		return client, nil
+	}
+}
+
+// validMessage - Evaluates if text is at most max bytes
+func validMessage(text string, max int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if len(text) > max {
+			return client, fmt.Errorf("Message must be at most %d bytes", max)
+		}
+		return client, nil
+	}
+}
+
+// inRoom - Evaluates if client has joined a room
+func inRoom(client interfaces.Client) (interfaces.Client, error) {
+	if rooms.current(client.GetConn()) == "" {
+		return client, errors.New("Client is not in a room")
+	}
+	return client, nil
+}
+
+// joinRoom - Add client to room and announce it to the room's members
+func joinRoom(room string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if !rooms.join(client.GetConn(), room) {
+			return client, nil
+		}
+		handle := client.GetHandle()
+		if registered, ok := clients.get(client.GetConn()); ok {
+			handle = registered.GetHandle()
+		}
+		err := queueRoomNotice(room, handle+" joined "+room)
+		return client, err
+	}
+}
+
+// leaveRoom - Remove client from room and announce it to the remaining members
+func leaveRoom(room string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if !rooms.leave(client.GetConn(), room) {
+			return client, errors.New("Client is not in room")
+		}
+		err := queueRoomNotice(room, client.GetHandle()+" left "+room)
+		return client, err
+	}
+}
+
+// leaveAllRooms - Remove client from every room it joined, announcing it to each
+func leaveAllRooms(client interfaces.Client) (interfaces.Client, error) {
+	var err error
+	for _, room := range rooms.leaveAll(client.GetConn()) {
+		if noticeErr := queueRoomNotice(room, client.GetHandle()+" left "+room); noticeErr != nil {
+			err = noticeErr
+		}
+	}
+	return client, err
+}
+
+// startSession - Issue a session token to the logged in client and send it to them
+func startSession(client interfaces.Client) (interfaces.Client, error) {
+	current, ok := clients.get(client.GetConn())
+	if !ok || current.GetHandle() == "" {
+		return client, errors.New("Client is not logged in")
+	}
+	token, err := sessions.Issue(current.GetHandle())
+	if err != nil {
+		return client, err
+	}
+	current.SetToken(token)
+	clients.add(current)
+	return queueSession(false)(current)
+}
+
+// resumeSession - Log the client in with the session identified by token
+func resumeSession(token string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		handle, err := sessions.Resume(token)
+		if err != nil {
+			return client, err
+		}
+		resumed := &models.Client{
+			Conn:   client.GetConn(),
+			Handle: handle,
+			Token:  token,
+		}
+		clients.add(resumed)
+		return queueSession(true)(resumed)
+	}
+}
+
+// queueSession - Send the client the token of its session and when it expires
+func queueSession(resumed bool) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		expires, err := sessions.Expires(client.GetToken())
+		if err != nil {
+			return client, err
+		}
+		return queueFrameToClient(protocol.TypeSession, protocol.SessionPayload{
+			Handle:  client.GetHandle(),
+			Token:   client.GetToken(),
+			Expires: expires,
+			Resumed: resumed,
+		})(client)
+	}
+}
+
+// touchSession - Record activity on the client's session, if it has one
+func touchSession(client interfaces.Client) (interfaces.Client, error) {
+	if client.GetToken() == "" {
+		return client, nil
+	}
+	return client, sessions.Touch(client.GetToken())
+}
+
+// revokeSession - End the client's session so its token can no longer be resumed
+func revokeSession(client interfaces.Client) (interfaces.Client, error) {
+	if client.GetToken() == "" {
+		return client, nil
+	}
+	return client, sessions.Revoke(client.GetToken())
+}
+
+// recordMessage - Add a message sent by sender to the message store, assigning its ID and time sent
+func recordMessage(sender interfaces.Client) func(interfaces.Message) (interfaces.Message, error) {
+	return func(message interfaces.Message) (interfaces.Message, error) {
+		message.SetSent(time.Now().UTC())
+		recorded, err := messages.Append(chatFromMessage(sender.GetHandle(), message))
+		if err != nil {
+			return message, err
+		}
+		message.SetID(recorded.ID)
+		index.Add(recorded)
+		return message, nil
+	}
+}
+
+// visibleTo - Accepts messages sent to one of rooms or sent directly to or by handle
+func visibleTo(handle string, rooms []string) func(protocol.ChatPayload) bool {
+	return func(message protocol.ChatPayload) bool {
+		if message.To != "" {
+			return message.To == handle || message.From == handle
+		}
+		for _, room := range rooms {
+			if message.Room == room {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// queueHistory - Queue up to n of the most recent messages the client may see
+// Messages from rooms the client has joined and its direct messages are included
+// An empty history is only sent if always is set
+func queueHistory(n int, always bool) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		current, ok := clients.get(client.GetConn())
+		if !ok {
+			return client, errors.New("Client is not connected")
+		}
+		history, err := messages.Recent(n, visibleTo(current.GetHandle(), rooms.joinedRooms(client.GetConn())))
+		if err != nil || (len(history) == 0 && !always) {
+			return client, err
+		}
+		return queueFrameToClient(protocol.TypeHistory, protocol.HistoryPayload{Messages: history})(client)
+	}
+}
+
+// queueSearchResults - Queue the requested page of messages matching text that the client may see
+func queueSearchResults(text string, query search.Query, pageSize int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		current, ok := clients.get(client.GetConn())
+		if !ok {
+			return client, errors.New("Client is not connected")
+		}
+		found := index.Search(query, visibleTo(current.GetHandle(), rooms.joinedRooms(client.GetConn())))
+		page, pages := search.Paginate(found, query.Page, pageSize)
+		return queueFrameToClient(protocol.TypeSearchResults, protocol.SearchResultsPayload{
+			Query:    text,
+			Page:     query.Page,
+			Pages:    pages,
+			Total:    len(found),
+			Messages: page,
+		})(client)
+	}
+}
+
+// forEachRecipient - Applies processors to every client that can see message
+// Room messages go to the room's current members and direct messages to every session of the sender and recipient
+func forEachRecipient(message protocol.ChatPayload, err error, processors ...func(interfaces.Client) (interfaces.Client, error)) error {
+	if message.To != "" {
+		return forEachSession([]string{message.To, message.From}, err, processors...)
+	}
+	return forEachRoomMember(message.Room, err, processors...)
+}
+
+// recorded - Fails if no message with the provided ID has been recorded
+func recorded(id string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		_, err := messages.Get(id)
+		return client, err
+	}
+}
+
+// mayModify - Fails unless the client wrote the message with the provided ID or is a moderator
+func mayModify(id string, moderators map[string]bool) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		message, err := messages.Get(id)
+		if err != nil {
+			return client, err
+		}
+		if message.From != client.GetHandle() && !moderators[client.GetHandle()] {
+			return client, errors.New("Client did not write message " + id)
+		}
+		return client, nil
+	}
+}
+
+// editMessage - Replace the text of the message with the provided ID and send the edit to its recipients
+func editMessage(id string, text string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		message, err := messages.Edit(id, text)
+		if err != nil {
+			return client, err
+		}
+		index.Update(message)
+		return client, forEachRecipient(message, nil, queueFrameToClient(protocol.TypeEdited, message))
+	}
+}
+
+// deleteMessage - Delete the message with the provided ID and tell its recipients
+func deleteMessage(id string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		message, err := messages.Get(id)
+		if err != nil {
+			return client, err
+		}
+		if err := messages.Delete(id); err != nil {
+			return client, err
+		}
+		index.Remove(id)
+		return client, forEachRecipient(message, nil, queueFrameToClient(protocol.TypeDeleted, protocol.DeletedPayload{
+			ID:   id,
+			Room: message.Room,
+			To:   message.To,
+			By:   client.GetHandle(),
+		}))
+	}
+}
+
+// validEmoji - Evaluates if emoji is made of emoji code points only and is at most max bytes
+func validEmoji(emoji string, max int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if len(emoji) > max || !isEmoji(emoji) {
+			return client, fmt.Errorf("Reactions must be a single emoji of at most %d bytes", max)
+		}
+		return client, nil
+	}
+}
+
+// addReaction - Record the client's reaction with emoji to the message with the provided ID and send the new counts to its recipients
+// A message holds at most max different emoji
+func addReaction(id string, emoji string, max int) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		message, err := messages.React(id, emoji, client.GetHandle(), max)
+		if err != nil {
+			return client, err
+		}
+		return client, queueReactions(message)
+	}
+}
+
+// removeReaction - Remove the client's reaction with emoji from the message with the provided ID and send the new counts to its recipients
+func removeReaction(id string, emoji string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		message, err := messages.Unreact(id, emoji, client.GetHandle())
+		if err != nil {
+			return client, err
+		}
+		return client, queueReactions(message)
+	}
+}
+
+// queueReactions - Send the reactions of message to everyone who can see it
+func queueReactions(message protocol.ChatPayload) error {
+	index.Update(message)
+	reactions := message.Reactions
+	if reactions == nil {
+		reactions = []protocol.ReactionPayload{}
+	}
+	return forEachRecipient(message, nil, queueFrameToClient(protocol.TypeReactions, protocol.ReactionsPayload{
+		ID:        message.ID,
+		Room:      message.Room,
+		To:        message.To,
+		Reactions: reactions,
+	}))
+}
+
+// visibleMessage - Fails unless the message with the provided ID exists and the client may see it
+func visibleMessage(id string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		message, err := messages.Get(id)
+		if err != nil {
+			return client, err
+		}
+		if !visibleTo(client.GetHandle(), rooms.joinedRooms(client.GetConn()))(message) {
+			return client, errors.New("Client cannot see message " + id)
+		}
+		return client, nil
+	}
+}
+
+// sendReply - Record a reply to the message with the provided ID and deliver it where the message was sent
+// The reply joins the parent's thread and quotes the first line of the parent
+func sendReply(id string, text string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		parent, err := messages.Get(id)
+		if err != nil {
+			return client, err
+		}
+		reply := protocol.ChatPayload{
+			From:    client.GetHandle(),
+			Room:    parent.Room,
+			Message: text,
+			Sent:    time.Now().UTC(),
+			ReplyTo: parent.ID,
+			Thread:  parent.Thread,
+			Quote:   &protocol.QuotePayload{From: parent.From, Text: firstLine(parent.Message)},
+		}
+		if reply.Thread == "" {
+			reply.Thread = parent.ID
+		}
+		if parent.To != "" {
+			// Direct replies go to the other participant of the conversation
+			reply.To = parent.To
+			if parent.To == client.GetHandle() {
+				reply.To = parent.From
+			}
+		}
+		recorded, err := messages.Append(reply)
+		if err != nil {
+			return client, err
+		}
+		index.Add(recorded)
+		return client, forEachRecipient(recorded, nil, queueFrameToClient(protocol.TypeChat, recorded))
+	}
+}
+
+// queueThread - Queue the thread the message with the provided ID belongs to
+func queueThread(id string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		thread, err := messages.Thread(id)
+		if err != nil {
+			return client, err
+		}
+		// Every message of a thread after the first names the message that began it
+		payload := protocol.ThreadPayload{ID: thread[0].ID, Messages: []protocol.ChatPayload{}}
+		if thread[0].Thread != "" {
+			payload.ID = thread[0].Thread
+		}
+		visible := visibleTo(client.GetHandle(), rooms.joinedRooms(client.GetConn()))
+		for _, message := range thread {
+			if visible(message) {
+				payload.Messages = append(payload.Messages, message)
+			}
+		}
+		return queueFrameToClient(protocol.TypeThread, payload)(client)
+	}
+}
+
+// firstLine - Returns the first line of text, shortened to quoteLen characters
+func firstLine(text string) string {
+	line := strings.SplitN(text, "\n", 2)[0]
+	if runes := []rune(line); len(runes) > quoteLen {
+		return string(runes[:quoteLen]) + "..."
+	}
+	return line
+}
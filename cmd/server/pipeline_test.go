@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// TestFramesNeverCarryPasswords - No frame written to any client may contain a pass field or a password
+func TestFramesNeverCarryPasswords(t *testing.T) {
+	server := newTestServer(t)
+	const secret = "Zq9xKp7w"
+	const wrong = "Wr0ngPw"
+
+	watcher, err := joinAs(server, "watcher", "lobby")
+	must(t, err)
+	defer watcher.close()
+	pat, err := dialTestServer(server)
+	must(t, err)
+	defer pat.close()
+
+	// Credentials are sent by newuser and login, including a failed attempt
+	must(t, pat.register("pat", secret))
+	must(t, pat.send("login pat "+wrong))
+	_, err = pat.expect(protocol.TypeError)
+	must(t, err)
+
+	// Chat, direct, notice, history, search and session frames
+	must(t, pat.send("send hello from pat"))
+	_, err = pat.expect(protocol.TypeChat)
+	must(t, err)
+	_, err = watcher.expect(protocol.TypeChat)
+	must(t, err)
+	must(t, pat.send("msg watcher psst"))
+	_, err = watcher.expect(protocol.TypeChat)
+	must(t, err)
+	must(t, pat.send("join ops"))
+	must(t, pat.expectNotice("Now talking in ops"))
+	must(t, pat.send("history"))
+	_, err = pat.expect(protocol.TypeHistory)
+	must(t, err)
+	must(t, pat.send("search hello"))
+	_, err = pat.expect(protocol.TypeSearchResults)
+	must(t, err)
+	must(t, pat.send("logout"))
+	must(t, pat.expectNotice("Successful logout"))
+	must(t, pat.send("login pat "+secret))
+	_, err = pat.expect(protocol.TypeSession)
+	must(t, err)
+	must(t, watcher.expectNotice("pat joined lobby"))
+
+	seen := make(map[string]bool)
+	for _, client := range []*testClient{watcher, pat} {
+		for _, data := range client.raw {
+			frame := string(data)
+			var envelope protocol.Envelope
+			must(t, json.Unmarshal(data, &envelope))
+			seen[envelope.Type] = true
+			if strings.Contains(frame, `"pass"`) {
+				t.Errorf("Frame has a pass field: %s", frame)
+			}
+			if strings.Contains(frame, secret) || strings.Contains(frame, wrong) {
+				t.Errorf("Frame contains a password: %s", frame)
+			}
+		}
+	}
+	for _, frameType := range []string{protocol.TypeChat, protocol.TypeNotice, protocol.TypeHistory, protocol.TypeSession, protocol.TypeSearchResults, protocol.TypeError} {
+		if !seen[frameType] {
+			t.Errorf("No %s frame was checked", frameType)
+		}
+	}
+}
+
+// TestFrameFromMessageDropsCredentials - Frames built from a message copy only the sender's handle, never its password
+func TestFrameFromMessageDropsCredentials(t *testing.T) {
+	const secret = "Zq9xKp7w"
+	sender := &models.Client{Handle: "pat", Pass: secret, Token: "token"}
+	for _, message := range []*models.Message{
+		{Command: "send", Body: "hello", Room: "lobby", Client: sender},
+		{Command: protocol.TypeNotice, Body: "hello", Room: "lobby", Client: sender},
+	} {
+		frame, err := frameFromMessage(message)
+		must(t, err)
+		data, err := json.Marshal(frame)
+		must(t, err)
+		if strings.Contains(string(data), `"pass"`) || strings.Contains(string(data), secret) {
+			t.Errorf("Frame carries the sender's password: %s", data)
+		}
+	}
+}
+
+// TestBroadcastSkipsUnreachableMembers - A member whose queue is stopped must not cut a broadcast short for the rest of the room
+func TestBroadcastSkipsUnreachableMembers(t *testing.T) {
+	server := newTestServer(t)
+	sender, err := joinAs(server, "sender", "ops")
+	must(t, err)
+	defer sender.close()
+	var listeners []*testClient
+	for _, handle := range []string{"gone1", "gone2", "gone3", "listener1", "listener2"} {
+		client, err := joinAs(server, handle, "ops")
+		must(t, err)
+		defer client.close()
+		if strings.HasPrefix(handle, "gone") {
+			// Stop the member's queue the way disconnect does before it leaves its rooms
+			writers.stop(clients.findByHandle(handle)[0].GetConn())
+		} else {
+			listeners = append(listeners, client)
+		}
+	}
+
+	must(t, sender.send("send still here?"))
+	for _, client := range append(listeners, sender) {
+		_, err := client.expect(protocol.TypeChat)
+		must(t, err)
+	}
+}
+
+// TestServerHandleIsReserved - No user may register as the server, so chat can never pass for a notice
+func TestServerHandleIsReserved(t *testing.T) {
+	server := newTestServer(t)
+	client, err := dialTestServer(server)
+	must(t, err)
+	defer client.close()
+
+	// Handles sent in a frame are not split on spaces, so padded handles must be refused too
+	for _, handle := range []string{"Server", "server", "SERVER", "Server\u00a0", "Server\r", " Server", "Server,x"} {
+		must(t, client.sendFrame("newuser", protocol.CredentialsPayload{Handle: handle, Pass: "secret"}))
+		frame, err := client.expect(protocol.TypeError)
+		must(t, err)
+		var failure protocol.ErrorPayload
+		must(t, frame.Decode(&failure))
+		if failure.Code != protocol.CodeInvalidArgument {
+			t.Errorf("newuser %q failed with %s, want %s", handle, failure.Code, protocol.CodeInvalidArgument)
+		}
+	}
+	if exists, err := users.Lookup("Server"); err != nil || exists {
+		t.Errorf("Server was registered")
+	}
+	must(t, client.send("login Server secret"))
+	if _, err := client.expect(protocol.TypeSession); err == nil {
+		t.Errorf("Logged in as Server")
+	}
+}
+
+// TestPaddedHandleCannotClaimHandle - A handle with trailing control characters must not register or pre-claim the plain handle
+func TestPaddedHandleCannotClaimHandle(t *testing.T) {
+	server := newTestServer(t)
+	squatter, err := dialTestServer(server)
+	must(t, err)
+	defer squatter.close()
+	for _, handle := range []string{"beth\r", "beth\u00a0", "beth\x00"} {
+		must(t, squatter.sendFrame("newuser", protocol.CredentialsPayload{Handle: handle, Pass: "secret"}))
+		_, err := squatter.expect(protocol.TypeError)
+		must(t, err)
+	}
+
+	beth, err := dialTestServer(server)
+	must(t, err)
+	defer beth.close()
+	must(t, beth.register("beth", "secret"))
+}
+
+// TestReactionsMustBeEmoji - Reactions that are not a single emoji are refused before they are recorded
+func TestReactionsMustBeEmoji(t *testing.T) {
+	server := newTestServer(t)
+	client, err := joinAs(server, "beth", "lobby")
+	must(t, err)
+	defer client.close()
+	must(t, client.send("send hello"))
+	_, err = client.expect(protocol.TypeChat)
+	must(t, err)
+
+	for _, emoji := range []string{"lol", "+1", strings.Repeat("👍", 9)} {
+		must(t, client.send("react 1 "+emoji))
+		frame, err := client.expect(protocol.TypeError)
+		must(t, err)
+		var failure protocol.ErrorPayload
+		must(t, frame.Decode(&failure))
+		if failure.Code != protocol.CodeInvalidArgument {
+			t.Errorf("react with %q failed with %s, want %s", emoji, failure.Code, protocol.CodeInvalidArgument)
+		}
+	}
+	must(t, client.send("react 1 👍🏽"))
+	frame, err := client.expect(protocol.TypeReactions)
+	must(t, err)
+	var reactions protocol.ReactionsPayload
+	must(t, frame.Decode(&reactions))
+	if len(reactions.Reactions) != 1 || reactions.Reactions[0].Emoji != "👍🏽" {
+		t.Errorf("Message has reactions %+v, want only 👍🏽", reactions.Reactions)
+	}
+}
@@ -1,111 +1,423 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/masonflint44/websocketLab/pkg/interfaces"
+	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+	"github.com/masonflint44/websocketLab/pkg/search"
+	"github.com/masonflint44/websocketLab/pkg/stores"
+)
+
 // TODO: update documentation
 // TODO: test updated processors
 
-func sendMessages() {
-	for {
-		message := <-outboundResponses
-		clientPipe(message.GetClient(), nil,
+// credentialsFromArgs - Build the client described by the handle and pass arguments of req
+func credentialsFromArgs(req request) interfaces.Client {
+	return &models.Client{
+		Handle: req.GetArg("handle"),
+		Pass:   req.GetArg("pass"),
+	}
+}
+
+func processLogout(req request) {
+	clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+		onClientError(
+			hasAuth,
+			clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeUnauthorized, "Client is not logged in")),
+		),
+		leaveAllRooms,
+		catchClientError(revokeSession, toClientErrorHandler(printError)),
+		logout,
+		queueCustomMessageToClient(serverHandle, "Successful logout"),
+	)
+}
+
+func processNewUser(limits limits) func(request) {
+	return func(req request) {
+		client, err := clientPipe(req.GetClient(), nil,
 			hasClient,
 			hasConn,
+		)
+		client, err = clientPipe(credentialsFromArgs(req), err,
+			setConn(client),
+			onClientError(
+				validHandle(limits.MaxHandle),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Handle must be 1 to %d letters, digits, '_' or '-'", limits.MaxHandle))),
+			),
+			onClientError(
+				unreservedHandle,
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, "Handle "+serverHandle+" is reserved")),
+			),
+			onClientError(
+				validPass(limits.MinPass, limits.MaxPass),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Pass must be between %d and %d characters", limits.MinPass, limits.MaxPass))),
+			),
 			onClientError(
-				sendMessageToClient(message),
-				toClientErrorHandler(printError),
+				uniqueHandle,
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeConflict, "Handle is already taken")),
+			),
+			onClientError(
+				register,
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to register new user")),
 			),
+			forgetPass,
+			queueCustomMessageToClient(serverHandle, "Welcome! Use 'login' to continue."),
 		)
 	}
 }
 
-func processLogoutRequests() {
-	for {
-		req := <-logoutRequests
+func processSend(max int) func(request) {
+	return func(req request) {
+		client, err := clientPipe(req.GetClient(), nil,
+			hasClient,
+			hasConn,
+			onClientError(
+				validMessage(req.GetArg("message"), max),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Message must be at most %d bytes", max))),
+			),
+			onClientError(
+				inRoom,
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeConflict, "Not in a room - Use 'join <room>' first")),
+			),
+		)
+		if err != nil {
+			return
+		}
+		room := rooms.current(client.GetConn())
+		message := &models.Message{
+			Command: "send",
+			Body:    req.GetArg("message"),
+			Room:    room,
+		}
+		_, recordErr := messagePipe(message, nil, recordMessage(client))
+		errorPipe(recordErr, printError)
+		err = forEachRoomMember(room, err,
+			setHandle(client),
+			queueMessageToClient(message),
+		)
+	}
+}
+
+func processLogin(replay int) func(request) {
+	return func(req request) {
+		credentials := credentialsFromArgs(req)
+		defer forgetPass(credentials)
 		clientPipe(req.GetClient(), nil,
 			hasClient,
 			hasConn,
 			onClientError(
 				hasAuth,
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Client is not logged in")),
+				clientProcessorToErrorHandler(onClientError(
+					loginAllowed(credentials.GetHandle()),
+					clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeRateLimited, "Too many login attempts - Try again later")),
+				)),
+				clientProcessorToErrorHandler(onClientError(
+					authorize(credentials),
+					clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeUnauthorized, "Unable to log in with provided credentials")),
+				)),
+				clientProcessorToErrorHandler(catchClientError(startSession, toClientErrorHandler(printError))),
+				clientProcessorToErrorHandler(queueCustomMessageToClient(serverHandle, "Successful login")),
+				clientProcessorToErrorHandler(joinRoom(defaultRoom)),
+				clientProcessorToErrorHandler(catchClientError(queueHistory(replay, false), toClientErrorHandler(printError))),
 			),
-			logout,
-			queueCustomMessageToClient("Server", "Successful logout"),
+			queueErrorToClient(protocol.CodeConflict, "Client is already logged in"),
 		)
 	}
 }
 
-func processNewUserRequests() {
-	for {
-		req := <-newUserRequests
-		client, err := clientPipe(req.GetClient(), nil,
+func processResume(req request) {
+	clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+		onClientError(
+			hasAuth,
+			clientProcessorToErrorHandler(onClientError(
+				resumeSession(req.GetArg("token")),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeSessionExpired, "Session has expired or was revoked - Please login")),
+			)),
+			clientProcessorToErrorHandler(queueCustomMessageToClient(serverHandle, "Session resumed")),
+			clientProcessorToErrorHandler(joinRoom(defaultRoom)),
+		),
+		queueErrorToClient(protocol.CodeConflict, "Client is already logged in"),
+	)
+}
+
+func processHelp(req request) {
+	clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+		queueCustomMessageToClient(serverHandle, helpText()),
+	)
+}
+
+func processJoin(limits limits) func(request) {
+	return func(req request) {
+		room := req.GetArg("room")
+		clientPipe(req.GetClient(), nil,
 			hasClient,
 			hasConn,
+			onClientError(
+				validRoom(room, limits.MaxRoom),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Room name must be less than %d characters", limits.MaxRoom))),
+			),
+			joinRoom(room),
+			queueCustomRoomMessageToClient(serverHandle, room, "Now talking in "+room),
 		)
-		message, err := messagePipe(req.GetMessage(), err,
-			hasMessage,
-		)
-		client, err = clientPipe(message.GetClient(), err,
+	}
+}
+
+func processLeave(req request) {
+	room := req.GetArg("room")
+	client, err := clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+		onClientError(
+			leaveRoom(room),
+			clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Not a member of "+room)),
+		),
+	)
+	if err != nil {
+		return
+	}
+	if current := rooms.current(client.GetConn()); current != "" {
+		queueCustomRoomMessageToClient(serverHandle, current, "Left "+room+" - Now talking in "+current)(client)
+	} else {
+		queueCustomMessageToClient(serverHandle, "Left "+room+" - Use 'join <room>' to keep chatting")(client)
+	}
+}
+
+func processRooms(req request) {
+	client, err := clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+	)
+	if err != nil {
+		return
+	}
+	current := rooms.current(client.GetConn())
+	lines := []string{"Rooms:"}
+	for _, room := range rooms.list() {
+		marker := ""
+		if room.Name == current {
+			marker = " *"
+		}
+		lines = append(lines, fmt.Sprintf("- %s (%d)%s", room.Name, room.Members, marker))
+	}
+	if len(lines) == 1 {
+		lines = append(lines, "No rooms - Use 'join <room>' to create one")
+	}
+	queueCustomMessageToClient(serverHandle, strings.Join(lines, "\n"))(client)
+}
+
+func processHistory(max int) func(request) {
+	return func(req request) {
+		count := defaultHistory
+		if arg := req.GetArg("count"); arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				queueErrorToClient(protocol.CodeInvalidArgument, "Count must be a positive number")(req.GetClient())
+				return
+			}
+			count = n
+		}
+		if count > max {
+			count = max
+		}
+		clientPipe(req.GetClient(), nil,
 			hasClient,
-			setConn(client),
+			hasConn,
 			onClientError(
-				validHandle,
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Handle must be less than 32 characters")),
+				queueHistory(count, true),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to read message history")),
 			),
+		)
+	}
+}
+
+func processSearch(pageSize int) func(request) {
+	return func(req request) {
+		text := req.GetArg("query")
+		query, err := search.ParseQuery(text)
+		if err != nil {
+			queueErrorToClient(protocol.CodeInvalidArgument, err.Error())(req.GetClient())
+			return
+		}
+		clientPipe(req.GetClient(), nil,
+			hasClient,
+			hasConn,
+			queueSearchResults(text, query, pageSize),
+		)
+	}
+}
+
+func processReply(max int) func(request) {
+	return func(req request) {
+		id := req.GetArg("id")
+		clientPipe(req.GetClient(), nil,
+			hasClient,
+			hasConn,
 			onClientError(
-				validPass,
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Pass must be between 4 and 8 characters")),
+				validMessage(req.GetArg("text"), max),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Message must be at most %d bytes", max))),
 			),
 			onClientError(
-				uniqueHandle,
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Handle is already taken")),
+				visibleMessage(id),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown message "+id)),
 			),
 			onClientError(
-				register,
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Unable to register new user")),
+				sendReply(id, req.GetArg("text")),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to reply to message "+id)),
 			),
-			queueCustomMessageToClient("Server", "Welcome! Use 'login' to continue."),
 		)
 	}
 }
 
-func processSendRequests() {
-	for {
-		req := <-sendRequests
-		client, err := clientPipe(req.GetClient(), nil,
+func processThread(req request) {
+	id := req.GetArg("id")
+	clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+		onClientError(
+			visibleMessage(id),
+			clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown message "+id)),
+		),
+		onClientError(
+			queueThread(id),
+			clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to read thread of message "+id)),
+		),
+	)
+}
+
+func processEdit(moderators map[string]bool, max int) func(request) {
+	return func(req request) {
+		id := req.GetArg("id")
+		clientPipe(req.GetClient(), nil,
 			hasClient,
 			hasConn,
 			onClientError(
-				hasAuth,
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Unauthorized - Please login")),
+				recorded(id),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown message "+id)),
+			),
+			onClientError(
+				mayModify(id, moderators),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeForbidden, "Only the author or a moderator can edit message "+id)),
+			),
+			onClientError(
+				validMessage(req.GetArg("text"), max),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Message must be at most %d bytes", max))),
+			),
+			onClientError(
+				editMessage(id, req.GetArg("text")),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to edit message "+id)),
 			),
-		)
-		err = forEachClient(err,
-			setHandle(client),
-			queueMessageToClient(req.GetMessage()),
 		)
 	}
 }
 
-func processLoginRequests() {
-	for {
-		req := <-loginRequests
-		message, err := messagePipe(req.GetMessage(), nil,
-			hasMessage,
+func processDelete(moderators map[string]bool) func(request) {
+	return func(req request) {
+		id := req.GetArg("id")
+		clientPipe(req.GetClient(), nil,
+			hasClient,
+			hasConn,
+			onClientError(
+				recorded(id),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown message "+id)),
+			),
+			onClientError(
+				mayModify(id, moderators),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeForbidden, "Only the author or a moderator can delete message "+id)),
+			),
+			onClientError(
+				deleteMessage(id),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to delete message "+id)),
+			),
 		)
-		messageClient, err := clientPipe(message.GetClient(), err,
+	}
+}
+
+func processReact(limits limits) func(request) {
+	return func(req request) {
+		id := req.GetArg("id")
+		emoji := req.GetArg("emoji")
+		clientPipe(req.GetClient(), nil,
 			hasClient,
+			hasConn,
+			onClientError(
+				visibleMessage(id),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown message "+id)),
+			),
+			onClientError(
+				validEmoji(emoji, limits.MaxEmoji),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Reactions must be a single emoji of at most %d bytes", limits.MaxEmoji))),
+			),
+			onClientError(
+				addReaction(id, emoji, limits.MaxReactions),
+				onMatchingError(stores.ErrAlreadyReacted, queueErrorToClient(protocol.CodeConflict, "You already reacted to message "+id+" with "+emoji)),
+				onMatchingError(stores.ErrTooManyReactions, queueErrorToClient(protocol.CodeConflict, fmt.Sprintf("Message %s already has %d different reactions", id, limits.MaxReactions))),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to react to message "+id)),
+			),
 		)
-		_, err = clientPipe(req.GetClient(), nil,
+	}
+}
+
+func processUnreact(req request) {
+	id := req.GetArg("id")
+	emoji := req.GetArg("emoji")
+	clientPipe(req.GetClient(), nil,
+		hasClient,
+		hasConn,
+		onClientError(
+			visibleMessage(id),
+			clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown message "+id)),
+		),
+		onClientError(
+			removeReaction(id, emoji),
+			onMatchingError(stores.ErrNotReacted, queueErrorToClient(protocol.CodeNotFound, "You have not reacted to message "+id+" with "+emoji)),
+			clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInternal, "Unable to remove reaction from message "+id)),
+		),
+	)
+}
+
+func processMsg(max int) func(request) {
+	return func(req request) {
+		recipient := req.GetArg("handle")
+		client, err := clientPipe(req.GetClient(), nil,
 			hasClient,
 			hasConn,
 			onClientError(
-				hasAuth,
-				clientProcessorToErrorHandler(onClientError(
-					authorize(messageClient),
-					clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Unable to log in with provided credentials")),
-				)),
-				clientProcessorToErrorHandler(queueCustomMessageToClient("Server", "Successful login")),
+				validMessage(req.GetArg("message"), max),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeInvalidArgument, fmt.Sprintf("Message must be at most %d bytes", max))),
+			),
+			onClientError(
+				registered(recipient),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeNotFound, "Unknown user "+recipient)),
 			),
-			queueCustomMessageToClient("Server", "Client is already logged in"),
+			onClientError(
+				online(recipient),
+				clientProcessorToErrorHandler(queueErrorToClient(protocol.CodeUnavailable, recipient+" is offline")),
+			),
+		)
+		if err != nil {
+			return
+		}
+		message := &models.Message{
+			Command:   "msg",
+			Body:      req.GetArg("message"),
+			Recipient: recipient,
+		}
+		_, recordErr := messagePipe(message, nil, recordMessage(client))
+		errorPipe(recordErr, printError)
+		// Deliver to the recipient and echo to each of the sender's sessions
+		forEachSession([]string{recipient, client.GetHandle()}, nil,
+			setHandle(client),
+			queueMessageToClient(message),
 		)
 	}
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/helpers"
+	"github.com/masonflint44/websocketLab/pkg/interfaces"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+var throttledRequests = expvar.NewMap("throttled_requests")
+var floodDisconnects = expvar.NewInt("flood_disconnects")
+
+// anyCommand - Name of the rate limit applied to commands without their own limit
+const anyCommand = "*"
+
+// sweepInterval - Time between removals of idle buckets
+const sweepInterval = time.Minute
+
+// rate - Token bucket limit written as "<per second>/<burst>", such as "2/5"
+type rate struct {
+	perSecond float64
+	burst     float64
+}
+
+// parseRate - Parse a limit such as "2/5"
+func parseRate(spec string) (rate, error) {
+	perSecond, burst := helpers.SplitOnFirstDelim('/', spec)
+	r := rate{}
+	var err error
+	r.perSecond, err = strconv.ParseFloat(perSecond, 64)
+	if err == nil {
+		r.burst, err = strconv.ParseFloat(burst, 64)
+	}
+	if err != nil || r.perSecond <= 0 || r.burst < 1 {
+		return rate{}, fmt.Errorf("Invalid rate %q - Expected <per second>/<burst> such as 2/5", spec)
+	}
+	return r, nil
+}
+
+// parseCommandRates - Parse comma separated limits such as "*=5/10,send=2/5"
+// The limit named * applies to every command without its own limit
+func parseCommandRates(spec string) (map[string]rate, error) {
+	rates := make(map[string]rate)
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, limit := helpers.SplitOnFirstDelim('=', entry)
+		if _, known := protocol.Commands[name]; !known && name != anyCommand {
+			return nil, fmt.Errorf("Invalid rate limit %q - Unknown command %s", entry, name)
+		}
+		r, err := parseRate(limit)
+		if err != nil {
+			return nil, err
+		}
+		rates[name] = r
+	}
+	return rates, nil
+}
+
+// tokenBucket - Holds up to burst tokens, refilled at perSecond
+type tokenBucket struct {
+	rate   rate
+	tokens float64
+	last   time.Time
+}
+
+// take - Remove a token from the bucket if one is available
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate.perSecond
+	if b.tokens > b.rate.burst {
+		b.tokens = b.rate.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full - Evaluates if the bucket would have refilled completely by now
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate.perSecond >= b.rate.burst
+}
+
+// rateLimiter - Token buckets limiting how often remote IPs and handles may act
+type rateLimiter struct {
+	mutex       sync.Mutex
+	buckets     map[string]*tokenBucket
+	lastSweep   time.Time
+	commands    map[string]rate
+	strikes     rate
+	loginHandle rate
+	loginIP     rate
+}
+
+// newRateLimiter - Create a rate limiter from the configured limits
+// Clients are disconnected once they are throttled more than strikes times in a minute
+func newRateLimiter(commandRates string, strikes int, loginHandle string, loginIP string) (*rateLimiter, error) {
+	commands, err := parseCommandRates(commandRates)
+	if err != nil {
+		return nil, err
+	}
+	limiter := &rateLimiter{
+		buckets:  make(map[string]*tokenBucket),
+		commands: commands,
+		strikes:  rate{perSecond: float64(strikes) / 60, burst: float64(strikes)},
+	}
+	if limiter.loginHandle, err = parseRate(loginHandle); err != nil {
+		return nil, err
+	}
+	if limiter.loginIP, err = parseRate(loginIP); err != nil {
+		return nil, err
+	}
+	return limiter, nil
+}
+
+// take - Take a token from the bucket called key, creating it full if needed
+func (l *rateLimiter) take(key string, r rate) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		for k, bucket := range l.buckets {
+			if bucket.full(now) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{rate: r, tokens: r.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	return bucket.take(now)
+}
+
+// remoteIP - Returns the IP address conn was opened from, without its port
+// Limits are keyed on the IP so reconnecting from a new port does not refill them
+func remoteIP(conn *websocket.Conn) string {
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return ip
+}
+
+// allowCommand - Evaluates if the client may invoke the command called name
+// Each remote IP and each logged in handle has its own bucket per limit
+// Commands without their own limit, including unknown ones, share the * bucket
+func (l *rateLimiter) allowCommand(client interfaces.Client, name string) bool {
+	r, ok := l.commands[name]
+	if !ok {
+		name = anyCommand
+		r, ok = l.commands[anyCommand]
+	}
+	if !ok {
+		return true
+	}
+	if !l.take("ip "+remoteIP(client.GetConn())+" "+name, r) {
+		return false
+	}
+	return client.GetHandle() == "" || l.take("handle "+client.GetHandle()+" "+name, r)
+}
+
+// strike - Record that the connection was throttled
+// Returns false once connections from its remote IP have been throttled too often
+func (l *rateLimiter) strike(conn *websocket.Conn) bool {
+	return l.take("strikes "+remoteIP(conn), l.strikes)
+}
+
+// allowLogin - Evaluates if a login attempt for handle may be made from conn
+// Attempts are limited per handle and per remote IP
+func (l *rateLimiter) allowLogin(conn *websocket.Conn, handle string) bool {
+	handleOK := l.take("login handle "+handle, l.loginHandle)
+	ipOK := l.take("login ip "+remoteIP(conn), l.loginIP)
+	return handleOK && ipOK
+}
+
+// throttle - Evaluates if the client may invoke the command called name
+// Throttled clients receive an error frame and are disconnected once they are throttled too often
+func throttle(client interfaces.Client, name string) bool {
+	if limiter.allowCommand(client, name) {
+		return true
+	}
+	if _, ok := commands.lookup(name); ok {
+		throttledRequests.Add(name, 1)
+	} else {
+		throttledRequests.Add(anyCommand, 1)
+	}
+	queueErrorToClient(protocol.CodeRateLimited, "Slow down - Too many '"+name+"' requests")(client)
+	if !limiter.strike(client.GetConn()) {
+		floodDisconnects.Add(1)
+		log.Println("Disconnecting flooding client", client.GetConn().RemoteAddr())
+		if pump, ok := writers.get(client.GetConn()); ok {
+			pump.shutdown(websocket.ClosePolicyViolation, "Rate limit exceeded", time.Now().Add(time.Second))
+		}
+		disconnect(client.GetConn())
+	}
+	return false
+}
+
+// loginAllowed - Fails once too many login attempts were made for handle or from the client's address
+func loginAllowed(handle string) func(interfaces.Client) (interfaces.Client, error) {
+	return func(client interfaces.Client) (interfaces.Client, error) {
+		if !limiter.allowLogin(client.GetConn(), handle) {
+			throttledRequests.Add("login", 1)
+			return client, fmt.Errorf("Too many login attempts for %s", handle)
+		}
+		return client, nil
+	}
+}
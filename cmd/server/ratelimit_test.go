@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// TestReconnectKeepsRateLimits - Buckets and strikes belong to the remote IP, so a new connection from it starts where the last one stopped
+func TestReconnectKeepsRateLimits(t *testing.T) {
+	server := newTestServer(t)
+	var err error
+	limiter, err = newRateLimiter("*=1000/1000,newuser=0.01/2", 3, "1000/1000", "1000/1000")
+	must(t, err)
+
+	first, err := dialTestServer(server)
+	must(t, err)
+	// Two registrations use up the burst and the next two are throttled, using two of three strikes
+	for i := 0; i < 4; i++ {
+		must(t, first.send(fmt.Sprintf("newuser user%d secret", i)))
+		if i < 2 {
+			must(t, first.expectNotice("Welcome!"))
+			continue
+		}
+		frame, err := first.expect(protocol.TypeError)
+		must(t, err)
+		var failure protocol.ErrorPayload
+		must(t, frame.Decode(&failure))
+		if failure.Code != protocol.CodeRateLimited {
+			t.Fatalf("newuser %d failed with %s, want %s", i, failure.Code, protocol.CodeRateLimited)
+		}
+	}
+	first.close()
+
+	second, err := dialTestServer(server)
+	must(t, err)
+	defer second.close()
+	must(t, second.send("newuser user4 secret"))
+	frame, err := second.expect(protocol.TypeError)
+	must(t, err)
+	var failure protocol.ErrorPayload
+	must(t, frame.Decode(&failure))
+	if failure.Code != protocol.CodeRateLimited {
+		t.Fatalf("newuser after reconnecting failed with %s, want %s", failure.Code, protocol.CodeRateLimited)
+	}
+	// The last strike disconnects the client
+	must(t, second.send("newuser user5 secret"))
+	for {
+		second.conn.SetReadDeadline(time.Now().Add(testTimeout))
+		if _, _, err := second.conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Errorf("Connection ended with %v, want a policy violation close", err)
+			}
+			break
+		}
+	}
+	if exists, err := users.Lookup("user4"); err != nil || exists {
+		t.Error("newuser was not limited after reconnecting")
+	}
+}
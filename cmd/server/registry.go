@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/interfaces"
+	"github.com/masonflint44/websocketLab/pkg/models"
+)
+
+// clientRegistry - Concurrency-safe set of connected clients keyed by connection
+// Lookups return copies so callers can modify them without affecting the registry
+type clientRegistry struct {
+	mutex   sync.RWMutex
+	clients map[*websocket.Conn]interfaces.Client
+}
+
+// newClientRegistry - Create an empty client registry
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[*websocket.Conn]interfaces.Client)}
+}
+
+// add - Store client under its connection, replacing any existing entry
+func (r *clientRegistry) add(client interfaces.Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clients[client.GetConn()] = models.CloneClient(client)
+}
+
+// remove - Remove the client using conn
+func (r *clientRegistry) remove(conn *websocket.Conn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.clients, conn)
+}
+
+// get - Returns a copy of the client using conn
+func (r *clientRegistry) get(conn *websocket.Conn) (interfaces.Client, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	client, ok := r.clients[conn]
+	if !ok {
+		return nil, false
+	}
+	return models.CloneClient(client), true
+}
+
+// findByHandle - Returns copies of every client authenticated as handle
+func (r *clientRegistry) findByHandle(handle string) []interfaces.Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	found := []interfaces.Client{}
+	if handle == "" {
+		return found
+	}
+	for _, client := range r.clients {
+		if client.GetHandle() == handle {
+			found = append(found, models.CloneClient(client))
+		}
+	}
+	return found
+}
+
+// snapshot - Returns copies of every registered client
+// The registry is not locked while the caller iterates the result
+func (r *clientRegistry) snapshot() []interfaces.Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	snapshot := make([]interfaces.Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		snapshot = append(snapshot, models.CloneClient(client))
+	}
+	return snapshot
+}
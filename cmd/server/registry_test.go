@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/interfaces"
+	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// TestClientRegistryConcurrentAccess - Run every registry operation from many goroutines at once; meant for go test -race
+func TestClientRegistryConcurrentAccess(t *testing.T) {
+	registry := newClientRegistry()
+	const workers = 50
+	const rounds = 100
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				for _, client := range registry.snapshot() {
+					client.SetHandle("changed by reader")
+				}
+				registry.findByHandle("user0")
+			}
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn := &websocket.Conn{}
+			handle := fmt.Sprintf("user%d", i%5)
+			for round := 0; round < rounds; round++ {
+				registry.add(&models.Client{Conn: conn, Handle: handle})
+				client, ok := registry.get(conn)
+				if !ok || client.GetHandle() != handle {
+					errs <- fmt.Errorf("get returned %v, %t after add", client, ok)
+					return
+				}
+				client.SetHandle("changed by worker")
+				if found := registry.findByHandle(handle); !containsConn(found, conn) {
+					errs <- fmt.Errorf("findByHandle(%s) is missing a registered client", handle)
+					return
+				}
+				registry.snapshot()
+				registry.remove(conn)
+				if _, ok := registry.get(conn); ok {
+					errs <- fmt.Errorf("get found a removed client")
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if clients := registry.snapshot(); len(clients) != 0 {
+		t.Errorf("registry holds %d clients after every client was removed", len(clients))
+	}
+}
+
+// containsConn - Evaluates if one of clients uses conn
+func containsConn(clients []interfaces.Client, conn *websocket.Conn) bool {
+	for _, client := range clients {
+		if client.GetConn() == conn {
+			return true
+		}
+	}
+	return false
+}
+
+// TestConcurrentLoginsAndBroadcasts - Connect, log in and chat from many clients at once through dispatch
+// Every member of the room must receive every message
+func TestConcurrentLoginsAndBroadcasts(t *testing.T) {
+	server := newTestServer(t)
+	const members = 8
+	const sends = 10
+
+	var ready, done sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, members)
+	ready.Add(members)
+	done.Add(members)
+	for i := 0; i < members; i++ {
+		go func(i int) {
+			defer done.Done()
+			client, err := joinAs(server, fmt.Sprintf("user%d", i), "ops")
+			ready.Done()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer client.close()
+			<-start
+			for j := 0; j < sends; j++ {
+				if err := client.send(fmt.Sprintf("send message %d from user%d", j, i)); err != nil {
+					errs <- err
+					return
+				}
+			}
+			received := make(map[string]bool)
+			for len(received) < members*sends {
+				frame, err := client.expect(protocol.TypeChat)
+				if err != nil {
+					errs <- fmt.Errorf("user%d received %d of %d messages - %v", i, len(received), members*sends, err)
+					return
+				}
+				var chat protocol.ChatPayload
+				if err := frame.Decode(&chat); err != nil {
+					errs <- err
+					return
+				}
+				if chat.Room != "ops" || received[chat.Message] {
+					errs <- fmt.Errorf("user%d received unexpected message %+v", i, chat)
+					return
+				}
+				received[chat.Message] = true
+			}
+		}(i)
+	}
+	ready.Wait()
+	close(start)
+	done.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -6,26 +6,26 @@ import (
 
 // request - Defines request for server processing
 type request interface {
-	// GetMessage - Used to get message sent by the client
-	GetMessage() interfaces.Message
 	// GetClient - Used to get client who made the request
 	GetClient() interfaces.Client
+	// GetArg - Used to get the value of a command argument by name
+	GetArg(name string) string
 }
 
 // serverRequest - Implementation of request for server processing
 type serverRequest struct {
-	// Message - Message sent by client
-	Message interfaces.Message
 	// Client - Client who made the request
 	Client interfaces.Client
-}
-
-// GetMessage - Used to get message sent by the client
-func (r serverRequest) GetMessage() interfaces.Message {
-	return r.Message
+	// Args - Command arguments decoded from the frame payload
+	Args map[string]string
 }
 
 // GetClient - Used to get client who made the request
 func (r serverRequest) GetClient() interfaces.Client {
 	return r.Client
 }
+
+// GetArg - Used to get the value of a command argument by name
+func (r serverRequest) GetArg(name string) string {
+	return r.Args[name]
+}
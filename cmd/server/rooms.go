@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultRoom - Room clients join when they log in
+const defaultRoom = "lobby"
+
+// roomSummary - Name and member count of a room
+type roomSummary struct {
+	Name    string
+	Members int
+}
+
+// roomRegistry - Concurrency-safe room membership keyed by connection
+// A connection may belong to several rooms; the most recently joined one is its current room
+type roomRegistry struct {
+	mutex   sync.RWMutex
+	members map[string]map[*websocket.Conn]bool
+	joined  map[*websocket.Conn][]string
+}
+
+// newRoomRegistry - Create an empty room registry
+func newRoomRegistry() *roomRegistry {
+	return &roomRegistry{
+		members: make(map[string]map[*websocket.Conn]bool),
+		joined:  make(map[*websocket.Conn][]string),
+	}
+}
+
+// join - Add conn to room and make it the connection's current room
+// Returns false if conn was already a member
+func (r *roomRegistry) join(conn *websocket.Conn, room string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	isMember := r.members[room][conn]
+	r.joined[conn] = append(without(r.joined[conn], room), room)
+	if isMember {
+		return false
+	}
+	if r.members[room] == nil {
+		r.members[room] = make(map[*websocket.Conn]bool)
+	}
+	r.members[room][conn] = true
+	return true
+}
+
+// leave - Remove conn from room
+// Returns false if conn was not a member
+func (r *roomRegistry) leave(conn *websocket.Conn, room string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.members[room][conn] {
+		return false
+	}
+	delete(r.members[room], conn)
+	if len(r.members[room]) == 0 {
+		delete(r.members, room)
+	}
+	r.joined[conn] = without(r.joined[conn], room)
+	if len(r.joined[conn]) == 0 {
+		delete(r.joined, conn)
+	}
+	return true
+}
+
+// leaveAll - Remove conn from every room, returning the rooms it left
+func (r *roomRegistry) leaveAll(conn *websocket.Conn) []string {
+	r.mutex.RLock()
+	rooms := append([]string{}, r.joined[conn]...)
+	r.mutex.RUnlock()
+	left := []string{}
+	for _, room := range rooms {
+		if r.leave(conn, room) {
+			left = append(left, room)
+		}
+	}
+	return left
+}
+
+// current - Returns the room conn most recently joined, or an empty string
+func (r *roomRegistry) current(conn *websocket.Conn) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	rooms := r.joined[conn]
+	if len(rooms) == 0 {
+		return ""
+	}
+	return rooms[len(rooms)-1]
+}
+
+// joinedRooms - Returns the rooms conn belongs to in the order they were joined
+func (r *roomRegistry) joinedRooms(conn *websocket.Conn) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]string{}, r.joined[conn]...)
+}
+
+// memberConns - Returns the connections in room
+func (r *roomRegistry) memberConns(room string) []*websocket.Conn {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	conns := make([]*websocket.Conn, 0, len(r.members[room]))
+	for conn := range r.members[room] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// list - Returns every room with at least one member, sorted by name
+func (r *roomRegistry) list() []roomSummary {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	list := make([]roomSummary, 0, len(r.members))
+	for name, members := range r.members {
+		list = append(list, roomSummary{Name: name, Members: len(members)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// without - Returns rooms with room removed
+func without(rooms []string, room string) []string {
+	kept := make([]string, 0, len(rooms))
+	for _, r := range rooms {
+		if r != room {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shuttingDown - Set once shutdown starts so new upgrades are refused
+var shuttingDown int32
+
+// isShuttingDown - Evaluates if the server has started shutting down
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// shutdown - Stop accepting connections, notify every client and close their connections
+// Outbound queues are flushed for at most timeout before connections are closed
+func shutdown(server *http.Server, timeout time.Duration) {
+	atomic.StoreInt32(&shuttingDown, 1)
+	deadline := time.Now().Add(timeout)
+
+	// Hijacked websocket connections are not affected by Shutdown, it only stops the listener
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error: Unable to stop listener -", err)
+	}
+
+	log.Println("Notifying clients...")
+	forEachClient(nil,
+		catchClientError(queueCustomMessageToClient(serverHandle, "Server shutting down")),
+	)
+
+	log.Println("Flushing outbound queues...")
+	writers.shutdownAll(websocket.CloseGoingAway, "Server shutting down", deadline)
+
+	log.Println("Disconnecting all clients...")
+	for _, client := range clients.snapshot() {
+		disconnect(client.GetConn())
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// overflowPolicy - Determines what happens when a connection's outbound queue is full
+type overflowPolicy string
+
+const (
+	// dropOldest - Discard the oldest queued message to make room
+	dropOldest overflowPolicy = "drop-oldest"
+	// dropNewest - Discard the message being queued
+	dropNewest overflowPolicy = "drop-newest"
+	// disconnectSlow - Disconnect the slow consumer
+	disconnectSlow overflowPolicy = "disconnect"
+)
+
+// Metrics - Published on /debug/vars
+var droppedMessages = expvar.NewMap("dropped_messages")
+var slowConsumerDisconnects = expvar.NewInt("slow_consumer_disconnects")
+var idleDisconnects = expvar.NewInt("idle_disconnects")
+
+// errQueueStopped - Returned when queueing to a connection that is closing
+var errQueueStopped = errors.New("Connection is closing")
+
+// errQueueFull - Returned when queueing to a slow consumer that is being disconnected
+var errQueueFull = errors.New("Outbound queue is full")
+
+// parseOverflowPolicy - Validates the name of an overflow policy
+func parseOverflowPolicy(name string) (overflowPolicy, error) {
+	switch policy := overflowPolicy(name); policy {
+	case dropOldest, dropNewest, disconnectSlow:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Unknown queue policy %q", name)
+	}
+}
+
+// writePump - Owns every write to a single connection
+// Frames are buffered in a bounded queue so a slow client only delays itself
+type writePump struct {
+	conn       *websocket.Conn
+	version    int
+	ping       time.Duration
+	queue      chan protocol.Envelope
+	policy     overflowPolicy
+	mutex      sync.Mutex
+	done       chan struct{}
+	stopOnce   sync.Once
+	closing    bool
+	overflowed bool
+	closed     chan struct{}
+	farewell   closeRequest
+}
+
+// closeRequest - Close frame a pump sends once its queue is flushed
+type closeRequest struct {
+	code     int
+	reason   string
+	deadline time.Time
+}
+
+// newWritePump - Create a write pump for conn with a queue of size frames
+// Frames are written using the protocol version negotiated for the connection and a ping is sent every ping
+func newWritePump(conn *websocket.Conn, version int, size int, policy overflowPolicy, ping time.Duration) *writePump {
+	return &writePump{
+		conn:    conn,
+		version: version,
+		ping:    ping,
+		queue:   make(chan protocol.Envelope, size),
+		policy:  policy,
+		done:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// run - Write queued frames and pings to the connection until the pump is stopped
+func (p *writePump) run() {
+	ticker := time.NewTicker(p.ping)
+	defer ticker.Stop()
+	for {
+		select {
+		case frame := <-p.queue:
+			p.write(frame)
+		case <-ticker.C:
+			errorPipe(p.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(p.ping)),
+				printError,
+			)
+		case <-p.done:
+			p.mutex.Lock()
+			closing := p.closing
+			p.mutex.Unlock()
+			if closing {
+				p.flush()
+				close(p.closed)
+			}
+			return
+		}
+	}
+}
+
+// write - Write frame to the connection using the negotiated version
+func (p *writePump) write(frame protocol.Envelope) {
+	frame.Version = p.version
+	errorPipe(p.conn.WriteJSON(frame),
+		printError,
+	)
+}
+
+// flush - Write every queued frame followed by the requested close frame
+func (p *writePump) flush() {
+	p.conn.SetWriteDeadline(p.farewell.deadline)
+	for {
+		select {
+		case frame := <-p.queue:
+			p.write(frame)
+		default:
+			message := websocket.FormatCloseMessage(p.farewell.code, p.farewell.reason)
+			errorPipe(p.conn.WriteControl(websocket.CloseMessage, message, p.farewell.deadline),
+				printError,
+			)
+			return
+		}
+	}
+}
+
+// enqueue - Queue frame for writing, applying the overflow policy if the queue is full
+func (p *writePump) enqueue(frame protocol.Envelope) error {
+	overflowed, err := p.push(frame)
+	if overflowed {
+		slowConsumerDisconnects.Add(1)
+		log.Println("Disconnecting slow consumer", p.conn.RemoteAddr())
+		// Disconnecting queues notices to the rest of the client's rooms, so it must not hold this pump's lock
+		go disconnect(p.conn)
+	}
+	return err
+}
+
+// push - Add frame to the queue under the pump's lock
+// Reports whether the queue overflowed for the first time under the disconnect policy
+func (p *writePump) push(frame protocol.Envelope) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	select {
+	case <-p.done:
+		return false, errQueueStopped
+	default:
+	}
+	select {
+	case p.queue <- frame:
+		return false, nil
+	default:
+	}
+
+	switch p.policy {
+	case dropOldest:
+		select {
+		case <-p.queue:
+		default:
+		}
+		select {
+		case p.queue <- frame:
+		default:
+		}
+		droppedMessages.Add(string(dropOldest), 1)
+		return false, nil
+	case dropNewest:
+		droppedMessages.Add(string(dropNewest), 1)
+		return false, nil
+	default:
+		overflowed := !p.overflowed
+		p.overflowed = true
+		return overflowed, errQueueFull
+	}
+}
+
+// stop - Stop writing to the connection; queued frames are discarded
+func (p *writePump) stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+// shutdown - Stop accepting frames, flush the queue and send a close frame with code and reason
+// Returns once the close frame is written or the deadline passes
+func (p *writePump) shutdown(code int, reason string, deadline time.Time) {
+	p.mutex.Lock()
+	select {
+	case <-p.done:
+		// Already stopped, nothing left to flush
+		p.mutex.Unlock()
+		return
+	default:
+	}
+	p.closing = true
+	p.farewell = closeRequest{code: code, reason: reason, deadline: deadline}
+	p.mutex.Unlock()
+	p.stop()
+	select {
+	case <-p.closed:
+	case <-time.After(time.Until(deadline)):
+	}
+}
+
+// writerRegistry - Concurrency-safe set of write pumps keyed by connection
+type writerRegistry struct {
+	mutex  sync.RWMutex
+	pumps  map[*websocket.Conn]*writePump
+	size   int
+	policy overflowPolicy
+	ping   time.Duration
+}
+
+// newWriterRegistry - Create an empty registry whose pumps use the provided queue size, policy and ping interval
+func newWriterRegistry(size int, policy overflowPolicy, ping time.Duration) *writerRegistry {
+	return &writerRegistry{
+		pumps:  make(map[*websocket.Conn]*writePump),
+		size:   size,
+		policy: policy,
+		ping:   ping,
+	}
+}
+
+// start - Start a write pump for conn using the negotiated protocol version
+func (r *writerRegistry) start(conn *websocket.Conn, version int) {
+	pump := newWritePump(conn, version, r.size, r.policy, r.ping)
+	r.mutex.Lock()
+	r.pumps[conn] = pump
+	r.mutex.Unlock()
+	go pump.run()
+}
+
+// get - Returns the write pump for conn
+func (r *writerRegistry) get(conn *websocket.Conn) (*writePump, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	pump, ok := r.pumps[conn]
+	return pump, ok
+}
+
+// shutdownAll - Flush and close every connection, waiting until the deadline at most
+func (r *writerRegistry) shutdownAll(code int, reason string, deadline time.Time) {
+	r.mutex.RLock()
+	pumps := make([]*writePump, 0, len(r.pumps))
+	for _, pump := range r.pumps {
+		pumps = append(pumps, pump)
+	}
+	r.mutex.RUnlock()
+
+	wg := sync.WaitGroup{}
+	for _, pump := range pumps {
+		wg.Add(1)
+		go func(pump *writePump) {
+			defer wg.Done()
+			pump.shutdown(code, reason, deadline)
+		}(pump)
+	}
+	wg.Wait()
+}
+
+// stop - Stop and remove the write pump for conn
+func (r *writerRegistry) stop(conn *websocket.Conn) {
+	r.mutex.Lock()
+	pump, ok := r.pumps[conn]
+	delete(r.pumps, conn)
+	r.mutex.Unlock()
+	if ok {
+		pump.stop()
+	}
+}
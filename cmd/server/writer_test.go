@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/masonflint44/websocketLab/pkg/models"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// stalledClient - Register handle as a member of room whose write pump never drains its queue of size frames
+// The connection has no read loop, so only the code under test can disconnect it
+func stalledClient(t *testing.T, handle string, room string, size int) (*websocket.Conn, *writePump) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(server.Close)
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	must(t, err)
+	t.Cleanup(func() { peer.Close() })
+	conn := <-accepted
+
+	clients.add(&models.Client{Conn: conn, Handle: handle})
+	rooms.join(conn, room)
+	pump := newWritePump(conn, protocol.SupportedVersions[0], size, disconnectSlow, time.Hour)
+	writers.mutex.Lock()
+	writers.pumps[conn] = pump
+	writers.mutex.Unlock()
+	return conn, pump
+}
+
+// TestSlowConsumerDisconnectReleasesLock - Overflowing a queue must not disconnect the client while holding the pump's lock
+// Disconnecting queues a notice to the rest of the room, whose pumps may be waiting on this one
+func TestSlowConsumerDisconnectReleasesLock(t *testing.T) {
+	newTestServer(t)
+	slowConn, slow := stalledClient(t, "slow", "ops", 1)
+	_, other := stalledClient(t, "other", "ops", 1)
+	frame, err := protocol.NewEnvelope(protocol.TypeNotice, protocol.NoticePayload{Message: "filler"})
+	must(t, err)
+	must(t, slow.enqueue(frame))
+	must(t, other.enqueue(frame))
+
+	// Hold the other member's pump the way a concurrent enqueue to it would
+	other.mutex.Lock()
+	result := make(chan error, 1)
+	go func() {
+		result <- slow.enqueue(frame)
+	}()
+	select {
+	case err := <-result:
+		if err != errQueueFull {
+			t.Errorf("enqueue returned %v, want %v", err, errQueueFull)
+		}
+	case <-time.After(testTimeout):
+		t.Error("enqueue blocked while disconnecting the slow consumer")
+	}
+	other.mutex.Unlock()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		if _, ok := clients.get(slowConn); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Slow consumer was not disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Current hashing parameters - Changing these causes stored hashes to be upgraded on next login
+const (
+	algorithm  = "argon2id"
+	memory     = 19 * 1024
+	iterations = 2
+	threads    = 1
+	saltLen    = 16
+	keyLen     = 32
+)
+
+// ErrMalformedHash - Returned when a stored hash cannot be parsed
+var ErrMalformedHash = errors.New("Stored password hash is malformed")
+
+// params - Parameters encoded in a stored hash
+type params struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// Hash - Hashes pass with a random per-user salt
+// The result is encoded as $argon2id$v=<version>$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func Hash(pass string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pass), salt, iterations, memory, threads, keyLen)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		algorithm, argon2.Version, memory, iterations, threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify - Evaluates if pass matches the stored hash
+// Legacy plaintext entries are compared directly; both paths compare in constant time
+func Verify(stored string, pass string) (bool, error) {
+	if IsLegacy(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1, nil
+	}
+	p, err := parse(stored)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(pass), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+// IsLegacy - Evaluates if stored is a plaintext password rather than a hash
+// Only values tagged with the hashing algorithm are hashes, so plaintext passwords starting with $ stay usable
+func IsLegacy(stored string) bool {
+	return !strings.HasPrefix(stored, "$"+algorithm+"$")
+}
+
+// NeedsRehash - Evaluates if stored should be replaced by a hash using the current parameters
+func NeedsRehash(stored string) bool {
+	if IsLegacy(stored) {
+		return true
+	}
+	p, err := parse(stored)
+	if err != nil {
+		return true
+	}
+	return p.version != argon2.Version ||
+		p.memory != memory ||
+		p.time != iterations ||
+		p.threads != threads ||
+		len(p.salt) != saltLen ||
+		len(p.key) != keyLen
+}
+
+// parse - Decodes the parameters of a stored hash
+func parse(stored string) (params, error) {
+	var p params
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || parts[1] != algorithm {
+		return p, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+		return p, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, ErrMalformedHash
+	}
+	p.salt, p.key = salt, key
+	return p, nil
+}
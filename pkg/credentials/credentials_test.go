@@ -0,0 +1,41 @@
+package credentials
+
+import "testing"
+
+func TestVerifyHash(t *testing.T) {
+	stored, err := Hash("Beth33")
+	if err != nil {
+		t.Fatalf("Hash returned error: %v", err)
+	}
+	if IsLegacy(stored) || NeedsRehash(stored) {
+		t.Errorf("fresh hash %q is treated as legacy or outdated", stored)
+	}
+	for pass, want := range map[string]bool{"Beth33": true, "beth33": false, "": false} {
+		if ok, err := Verify(stored, pass); err != nil || ok != want {
+			t.Errorf("Verify(hash, %q) = %t, %v; want %t", pass, ok, err, want)
+		}
+	}
+}
+
+func TestVerifyLegacyStartingWithDollar(t *testing.T) {
+	for _, stored := range []string{"$ecret", "$argon2", "$bcrypt$x$y$z$w"} {
+		if !IsLegacy(stored) {
+			t.Errorf("IsLegacy(%q) = false, want true", stored)
+		}
+		if !NeedsRehash(stored) {
+			t.Errorf("NeedsRehash(%q) = false, want true", stored)
+		}
+		if ok, err := Verify(stored, stored); err != nil || !ok {
+			t.Errorf("Verify(%q, %q) = %t, %v; want true", stored, stored, ok, err)
+		}
+		if ok, err := Verify(stored, "wrong"); err != nil || ok {
+			t.Errorf("Verify(%q, wrong) = %t, %v; want false", stored, ok, err)
+		}
+	}
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	if _, err := Verify("$argon2id$v=19$garbage", "pass"); err != ErrMalformedHash {
+		t.Errorf("Verify of malformed hash returned %v, want ErrMalformedHash", err)
+	}
+}
@@ -10,10 +10,14 @@ type Client interface {
 	GetPass() string
 	// GetConn - Returns connection to server
 	GetConn() *websocket.Conn
+	// GetToken - Returns token of the session the client is logged in with
+	GetToken() string
 	// SetHandle - Set handle used to identify user
 	SetHandle(handle string)
 	// SetPass - Set password used to authenticate
 	SetPass(pass string)
 	// SetConn - Set connection to server
 	SetConn(conn *websocket.Conn)
+	// SetToken - Set token of the session the client is logged in with
+	SetToken(token string)
 }
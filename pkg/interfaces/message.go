@@ -1,5 +1,7 @@
 package interfaces
 
+import "time"
+
 // Message - Defines a message that includes the following:
 type Message interface {
 	// GetCommand - Used to allow the processor to determine how to interpret the message
@@ -8,10 +10,26 @@ type Message interface {
 	GetBody() string
 	// GetClient - Returns information about client sending the message
 	GetClient() Client
+	// GetRoom - Returns the room the message was sent to
+	GetRoom() string
+	// GetRecipient - Returns the handle a direct message was sent to
+	GetRecipient() string
+	// GetID - Returns the identifier assigned when the message was recorded
+	GetID() string
+	// GetSent - Returns the time the server accepted the message
+	GetSent() time.Time
 	// SetCommand - Used to allow the processor to determine how to interpret the message
 	SetCommand(command string)
 	// SetBody - Set body of the message
 	SetBody(body string)
 	// SetClient - Set information about client sending the message
 	SetClient(client Client)
+	// SetRoom - Set the room the message was sent to
+	SetRoom(room string)
+	// SetRecipient - Set the handle a direct message was sent to
+	SetRecipient(recipient string)
+	// SetID - Set the identifier assigned when the message was recorded
+	SetID(id string)
+	// SetSent - Set the time the server accepted the message
+	SetSent(sent time.Time)
 }
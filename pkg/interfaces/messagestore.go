@@ -0,0 +1,27 @@
+package interfaces
+
+import "github.com/masonflint44/websocketLab/pkg/protocol"
+
+// MessageStore - Defines storage for the history of messages sent to rooms and users
+type MessageStore interface {
+	// Append - Record message, assigning it an ID, and return the recorded message
+	Append(message protocol.ChatPayload) (protocol.ChatPayload, error)
+	// Get - Returns the message with the provided ID
+	Get(id string) (protocol.ChatPayload, error)
+	// Edit - Replace the text of the message with the provided ID, marking it edited, and return the updated message
+	Edit(id string, text string) (protocol.ChatPayload, error)
+	// Delete - Remove the message with the provided ID
+	Delete(id string) error
+	// React - Record handle's reaction with emoji to the message with the provided ID and return the updated message
+	// A new emoji is refused once the message has limit different emoji
+	React(id string, emoji string, handle string, limit int) (protocol.ChatPayload, error)
+	// Unreact - Remove handle's reaction with emoji from the message with the provided ID and return the updated message
+	Unreact(id string, emoji string, handle string) (protocol.ChatPayload, error)
+	// Thread - Returns the thread the message with the provided ID belongs to
+	// The message that began the thread comes first, followed by its replies oldest first
+	Thread(id string) ([]protocol.ChatPayload, error)
+	// All - Returns every recorded message, oldest first
+	All() ([]protocol.ChatPayload, error)
+	// Recent - Returns up to n of the most recent messages accepted by visible, oldest first
+	Recent(n int, visible func(protocol.ChatPayload) bool) ([]protocol.ChatPayload, error)
+}
@@ -0,0 +1,18 @@
+package interfaces
+
+import "time"
+
+// SessionStore - Defines storage for the sessions issued to logged in clients
+// Sessions are identified by an opaque token and expire when unused for too long
+type SessionStore interface {
+	// Issue - Start a session for the user with the provided handle and return its token
+	Issue(handle string) (string, error)
+	// Resume - Returns the handle of the unexpired session identified by token and records it as seen
+	Resume(token string) (string, error)
+	// Touch - Record activity on the session identified by token
+	Touch(token string) error
+	// Expires - Returns the time the session identified by token expires if left unused
+	Expires(token string) (time.Time, error)
+	// Revoke - End the session identified by token
+	Revoke(token string) error
+}
@@ -0,0 +1,15 @@
+package interfaces
+
+// UserStore - Defines storage for registered users and their credentials
+type UserStore interface {
+	// Create - Register a new user with the provided credentials
+	Create(handle string, pass string) error
+	// Lookup - Evaluates if a user with the provided handle is registered
+	Lookup(handle string) (bool, error)
+	// Verify - Evaluates if the provided credentials match a registered user
+	Verify(handle string, pass string) (bool, error)
+	// Delete - Remove the user with the provided handle
+	Delete(handle string) error
+	// List - Returns the handles of all registered users
+	List() ([]string, error)
+}
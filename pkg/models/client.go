@@ -6,13 +6,16 @@ import (
 )
 
 // Client - Defines credentials and connection used to connect to server
+// Pass, Conn and Token are never marshaled so a client cannot leak them onto the wire
 type Client struct {
 	// Handle - Handle used to identify user
 	Handle string
 	// Pass - Password used to authenticate
-	Pass string
+	Pass string `json:"-"`
 	// Conn - Connection to server
-	Conn *websocket.Conn
+	Conn *websocket.Conn `json:"-"`
+	// Token - Token of the session the client is logged in with
+	Token string `json:"-"`
 }
 
 // GetHandle - Returns handle used to identify user
@@ -30,6 +33,11 @@ func (c *Client) GetConn() *websocket.Conn {
 	return c.Conn
 }
 
+// GetToken - Returns token of the session the client is logged in with
+func (c *Client) GetToken() string {
+	return c.Token
+}
+
 // SetHandle - Set handle used to identify user
 func (c *Client) SetHandle(handle string) {
 	c.Handle = handle
@@ -45,11 +53,17 @@ func (c *Client) SetConn(conn *websocket.Conn) {
 	c.Conn = conn
 }
 
+// SetToken - Set token of the session the client is logged in with
+func (c *Client) SetToken(token string) {
+	c.Token = token
+}
+
 // CloneClient - Make copy of client
 func CloneClient(c interfaces.Client) interfaces.Client {
 	return &Client{
 		Conn:   c.GetConn(),
 		Handle: c.GetHandle(),
 		Pass:   c.GetPass(),
+		Token:  c.GetToken(),
 	}
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/masonflint44/websocketLab/pkg/interfaces"
 )
 
@@ -12,6 +14,14 @@ type Message struct {
 	Body string
 	// Client - Information about client sending the message
 	Client interfaces.Client
+	// Room - Room the message was sent to
+	Room string
+	// Recipient - Handle a direct message was sent to
+	Recipient string
+	// ID - Identifier assigned when the message was recorded
+	ID string
+	// Sent - Time the server accepted the message
+	Sent time.Time
 }
 
 // GetCommand - Used to allow the processor to determine how to interpret the message
@@ -29,6 +39,26 @@ func (m *Message) GetClient() interfaces.Client {
 	return m.Client
 }
 
+// GetRoom - Returns the room the message was sent to
+func (m *Message) GetRoom() string {
+	return m.Room
+}
+
+// GetRecipient - Returns the handle a direct message was sent to
+func (m *Message) GetRecipient() string {
+	return m.Recipient
+}
+
+// GetID - Returns the identifier assigned when the message was recorded
+func (m *Message) GetID() string {
+	return m.ID
+}
+
+// GetSent - Returns the time the server accepted the message
+func (m *Message) GetSent() time.Time {
+	return m.Sent
+}
+
 // SetCommand - Used to allow the processor to determine how to interpret the message
 func (m *Message) SetCommand(command string) {
 	m.Command = command
@@ -44,11 +74,35 @@ func (m *Message) SetClient(client interfaces.Client) {
 	m.Client = client
 }
 
+// SetRoom - Set the room the message was sent to
+func (m *Message) SetRoom(room string) {
+	m.Room = room
+}
+
+// SetRecipient - Set the handle a direct message was sent to
+func (m *Message) SetRecipient(recipient string) {
+	m.Recipient = recipient
+}
+
+// SetID - Set the identifier assigned when the message was recorded
+func (m *Message) SetID(id string) {
+	m.ID = id
+}
+
+// SetSent - Set the time the server accepted the message
+func (m *Message) SetSent(sent time.Time) {
+	m.Sent = sent
+}
+
 // CloneMessage - Make copy of message
 func CloneMessage(m interfaces.Message) interfaces.Message {
 	return &Message{
-		Body:    m.GetBody(),
-		Client:  m.GetClient(),
-		Command: m.GetCommand(),
+		Body:      m.GetBody(),
+		Client:    m.GetClient(),
+		Command:   m.GetCommand(),
+		Room:      m.GetRoom(),
+		Recipient: m.GetRecipient(),
+		ID:        m.GetID(),
+		Sent:      m.GetSent(),
 	}
 }
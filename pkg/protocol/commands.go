@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/masonflint44/websocketLab/pkg/helpers"
+)
+
+// Arg - Describes an argument of a command frame
+// Arguments are carried in the payload as string fields named after the argument
+type Arg struct {
+	// Name - Name of the payload field holding the argument
+	Name string
+	// Optional - Argument may be omitted
+	Optional bool
+	// Rest - Argument consumes the remainder of the line, including spaces
+	Rest bool
+}
+
+// Commands - Arguments of every command frame, keyed by frame type
+var Commands = map[string][]Arg{
+	"login":   {{Name: "handle"}, {Name: "pass"}},
+	"newuser": {{Name: "handle"}, {Name: "pass"}},
+	"resume":  {{Name: "token"}},
+	"send":    {{Name: "message", Rest: true}},
+	"msg":     {{Name: "handle"}, {Name: "message", Rest: true}},
+	"reply":   {{Name: "id"}, {Name: "text", Rest: true}},
+	"thread":  {{Name: "id"}},
+	"edit":    {{Name: "id"}, {Name: "text", Rest: true}},
+	"delete":  {{Name: "id"}},
+	"react":   {{Name: "id"}, {Name: "emoji"}},
+	"unreact": {{Name: "id"}, {Name: "emoji"}},
+	"join":    {{Name: "room"}},
+	"leave":   {{Name: "room"}},
+	"rooms":   {},
+	"history": {{Name: "count", Optional: true}},
+	"search":  {{Name: "query", Rest: true}},
+	"logout":  {},
+	"help":    {},
+}
+
+// Usage - Describe how to invoke the command called name
+func Usage(name string) string {
+	usage := name
+	for _, arg := range Commands[name] {
+		if arg.Optional {
+			usage += " [" + arg.Name + "]"
+		} else {
+			usage += " <" + arg.Name + ">"
+		}
+	}
+	return usage
+}
+
+// ParseArgs - Split line into the arguments of the command called name
+func ParseArgs(name string, line string) (map[string]string, error) {
+	args := make(map[string]string)
+	rest := strings.TrimSpace(line)
+	for _, arg := range Commands[name] {
+		var value string
+		if arg.Rest {
+			value, rest = rest, ""
+		} else {
+			value, rest = helpers.SplitOnFirstDelim(' ', rest)
+		}
+		if value != "" || !arg.Optional {
+			args[arg.Name] = value
+		}
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("Usage: %s", Usage(name))
+	}
+	return args, ValidateArgs(name, args)
+}
+
+// ValidateArgs - Ensures args holds every argument required by the command called name
+func ValidateArgs(name string, args map[string]string) error {
+	for _, arg := range Commands[name] {
+		value := args[arg.Name]
+		if value == "" && !arg.Optional {
+			return fmt.Errorf("Usage: %s", Usage(name))
+		}
+		if !arg.Rest && strings.ContainsAny(value, " \t\n") {
+			return fmt.Errorf("Usage: %s", Usage(name))
+		}
+	}
+	return nil
+}
+
+// ValidHandle - Evaluates if handle is made only of letters, digits, '_' and '-'
+// Handles are stored and compared exactly, so nothing that could be trimmed or used as a delimiter is allowed
+func ValidHandle(handle string) bool {
+	if handle == "" {
+		return false
+	}
+	for _, r := range handle {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLine - Build a command frame from a line of user input such as "join lobby"
+// Commands unknown to this build are sent without arguments so the server can reject them
+func ParseLine(line string) (Envelope, error) {
+	name, rest := helpers.SplitOnFirstDelim(' ', line)
+	if _, ok := Commands[name]; !ok {
+		return NewEnvelope(name, nil)
+	}
+	args, err := ParseArgs(name, rest)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return NewEnvelope(name, args)
+}
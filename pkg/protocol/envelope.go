@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Version - Newest protocol version spoken by this build
+const Version = 1
+
+// SupportedVersions - Protocol versions spoken by this build, newest first
+var SupportedVersions = []int{1}
+
+// Frame types sent by the server
+// Frames sent by the client use the name of the command they invoke as their type
+const (
+	// TypeHello - First frame sent by the client, listing the versions it speaks
+	TypeHello = "hello"
+	// TypeWelcome - Reply to hello naming the version chosen by the server
+	TypeWelcome = "welcome"
+	// TypeSession - Token of the session started by login or resume
+	TypeSession = "session"
+	// TypeChat - Message sent by a user to a room or directly to another user
+	TypeChat = "chat"
+	// TypeEdited - Message that was edited, sent to everyone who received it
+	TypeEdited = "edited"
+	// TypeDeleted - Message that was deleted, sent to everyone who received it
+	TypeDeleted = "deleted"
+	// TypeReactions - Reactions a message has after one was added or removed, sent to everyone who received it
+	TypeReactions = "reactions"
+	// TypeThread - Message that began a thread and its replies
+	TypeThread = "thread"
+	// TypeHistory - Recent messages the client may see, sent on request and after login
+	TypeHistory = "history"
+	// TypeSearchResults - Page of messages matching a search
+	TypeSearchResults = "search_results"
+	// TypeNotice - Informational message from the server
+	TypeNotice = "notice"
+	// TypeError - Request could not be completed
+	TypeError = "error"
+)
+
+// ErrNoCommonVersion - Returned when client and server share no protocol version
+var ErrNoCommonVersion = errors.New("No common protocol version")
+
+// Envelope - Wraps every frame sent between client and server
+type Envelope struct {
+	// Version - Protocol version the frame was written with
+	Version int `json:"version"`
+	// Type - Determines how Payload is interpreted
+	Type string `json:"type"`
+	// ID - Unique identifier of the frame
+	ID string `json:"id"`
+	// Timestamp - Time the frame was created
+	Timestamp time.Time `json:"timestamp"`
+	// Payload - Type-specific body of the frame
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewEnvelope - Wrap payload in a frame of the provided type using the current version
+func NewEnvelope(frameType string, payload interface{}) (Envelope, error) {
+	return NewVersionedEnvelope(Version, frameType, payload)
+}
+
+// NewVersionedEnvelope - Wrap payload in a frame of the provided type and version
+func NewVersionedEnvelope(version int, frameType string, payload interface{}) (Envelope, error) {
+	envelope := Envelope{
+		Version:   version,
+		Type:      frameType,
+		ID:        NewID(),
+		Timestamp: time.Now().UTC(),
+	}
+	if payload == nil {
+		return envelope, nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return envelope, err
+	}
+	envelope.Payload = raw
+	return envelope, nil
+}
+
+// Decode - Unmarshal the payload of the frame into v
+func (e Envelope) Decode(v interface{}) error {
+	if len(e.Payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(e.Payload, v)
+}
+
+// NewID - Returns a random identifier for a frame
+func NewID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
+
+// Negotiate - Returns the newest version present in both offered and SupportedVersions
+func Negotiate(offered []int) (int, error) {
+	best := 0
+	for _, version := range offered {
+		for _, supported := range SupportedVersions {
+			if version == supported && version > best {
+				best = version
+			}
+		}
+	}
+	if best == 0 {
+		return 0, ErrNoCommonVersion
+	}
+	return best, nil
+}
@@ -0,0 +1,29 @@
+package protocol
+
+// Error codes carried by error frames
+const (
+	// CodeBadFrame - Frame could not be decoded or used the wrong version
+	CodeBadFrame = "bad_frame"
+	// CodeUnsupportedVersion - Client and server share no protocol version
+	CodeUnsupportedVersion = "unsupported_version"
+	// CodeUnknownCommand - Frame type is not a known command
+	CodeUnknownCommand = "unknown_command"
+	// CodeInvalidArgument - Command arguments are missing or malformed
+	CodeInvalidArgument = "invalid_argument"
+	// CodeUnauthorized - Command requires a logged in client
+	CodeUnauthorized = "unauthorized"
+	// CodeSessionExpired - Session token is unknown, expired or revoked
+	CodeSessionExpired = "session_expired"
+	// CodeForbidden - Client may not perform the request, such as editing another user's message
+	CodeForbidden = "forbidden"
+	// CodeConflict - Request conflicts with the current state, such as a taken handle
+	CodeConflict = "conflict"
+	// CodeNotFound - Referenced user, room or message does not exist
+	CodeNotFound = "not_found"
+	// CodeUnavailable - Referenced user is not online
+	CodeUnavailable = "unavailable"
+	// CodeRateLimited - Client sent requests faster than the server allows
+	CodeRateLimited = "rate_limited"
+	// CodeInternal - Server failed to complete the request
+	CodeInternal = "internal"
+)
@@ -0,0 +1,307 @@
+package protocol
+
+import "time"
+
+// HelloPayload - Payload of a hello frame
+type HelloPayload struct {
+	// Versions - Protocol versions spoken by the client
+	Versions []int `json:"versions"`
+}
+
+// WelcomePayload - Payload of a welcome frame
+type WelcomePayload struct {
+	// Version - Protocol version used for the rest of the connection
+	Version int `json:"version"`
+	// Message - Greeting shown to the user
+	Message string `json:"message"`
+}
+
+// CommandPayload - Typed payload of a command frame sent by the client
+type CommandPayload interface {
+	// Args - Returns the arguments carried by the payload, keyed by the names declared in Commands
+	Args() map[string]string
+}
+
+// commandPayloads - Creates the typed payload of every command frame, keyed by frame type
+var commandPayloads = map[string]func() CommandPayload{
+	"login":   func() CommandPayload { return &CredentialsPayload{} },
+	"newuser": func() CommandPayload { return &CredentialsPayload{} },
+	"resume":  func() CommandPayload { return &ResumePayload{} },
+	"send":    func() CommandPayload { return &SendPayload{} },
+	"msg":     func() CommandPayload { return &DirectPayload{} },
+	"reply":   func() CommandPayload { return &ReplyPayload{} },
+	"thread":  func() CommandPayload { return &MessageIDPayload{} },
+	"edit":    func() CommandPayload { return &EditPayload{} },
+	"delete":  func() CommandPayload { return &MessageIDPayload{} },
+	"react":   func() CommandPayload { return &ReactPayload{} },
+	"unreact": func() CommandPayload { return &ReactPayload{} },
+	"join":    func() CommandPayload { return &RoomPayload{} },
+	"leave":   func() CommandPayload { return &RoomPayload{} },
+	"rooms":   func() CommandPayload { return &EmptyPayload{} },
+	"history": func() CommandPayload { return &HistoryRequestPayload{} },
+	"search":  func() CommandPayload { return &SearchPayload{} },
+	"logout":  func() CommandPayload { return &EmptyPayload{} },
+	"help":    func() CommandPayload { return &EmptyPayload{} },
+}
+
+// NewCommandPayload - Returns an empty typed payload for the command called name to decode a frame into
+func NewCommandPayload(name string) (CommandPayload, bool) {
+	create, ok := commandPayloads[name]
+	if !ok {
+		return nil, false
+	}
+	return create(), true
+}
+
+// CredentialsPayload - Payload of login and newuser frames
+type CredentialsPayload struct {
+	Handle string `json:"handle"`
+	Pass   string `json:"pass"`
+}
+
+// Args - Returns the handle and pass arguments
+func (p CredentialsPayload) Args() map[string]string {
+	return map[string]string{"handle": p.Handle, "pass": p.Pass}
+}
+
+// ResumePayload - Payload of a resume frame
+type ResumePayload struct {
+	Token string `json:"token"`
+}
+
+// Args - Returns the token argument
+func (p ResumePayload) Args() map[string]string {
+	return map[string]string{"token": p.Token}
+}
+
+// SessionPayload - Payload of a session frame
+// The token logs the client back in with resume after reconnecting, until it expires or is revoked by logout
+type SessionPayload struct {
+	// Handle - Handle the session is logged in as
+	Handle string `json:"handle"`
+	// Token - Opaque token identifying the session
+	Token string `json:"token"`
+	// Expires - Time the session expires if left unused
+	Expires time.Time `json:"expires"`
+	// Resumed - Session was resumed rather than started by login
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// SendPayload - Payload of a send frame
+type SendPayload struct {
+	Message string `json:"message"`
+}
+
+// Args - Returns the message argument
+func (p SendPayload) Args() map[string]string {
+	return map[string]string{"message": p.Message}
+}
+
+// DirectPayload - Payload of a msg frame
+type DirectPayload struct {
+	Handle  string `json:"handle"`
+	Message string `json:"message"`
+}
+
+// Args - Returns the handle and message arguments
+func (p DirectPayload) Args() map[string]string {
+	return map[string]string{"handle": p.Handle, "message": p.Message}
+}
+
+// ReplyPayload - Payload of a reply frame
+type ReplyPayload struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// Args - Returns the id and text arguments
+func (p ReplyPayload) Args() map[string]string {
+	return map[string]string{"id": p.ID, "text": p.Text}
+}
+
+// EditPayload - Payload of an edit frame
+type EditPayload struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// Args - Returns the id and text arguments
+func (p EditPayload) Args() map[string]string {
+	return map[string]string{"id": p.ID, "text": p.Text}
+}
+
+// MessageIDPayload - Payload of delete and thread frames
+type MessageIDPayload struct {
+	ID string `json:"id"`
+}
+
+// Args - Returns the id argument
+func (p MessageIDPayload) Args() map[string]string {
+	return map[string]string{"id": p.ID}
+}
+
+// ReactPayload - Payload of react and unreact frames
+type ReactPayload struct {
+	ID    string `json:"id"`
+	Emoji string `json:"emoji"`
+}
+
+// Args - Returns the id and emoji arguments
+func (p ReactPayload) Args() map[string]string {
+	return map[string]string{"id": p.ID, "emoji": p.Emoji}
+}
+
+// RoomPayload - Payload of join and leave frames
+type RoomPayload struct {
+	Room string `json:"room"`
+}
+
+// Args - Returns the room argument
+func (p RoomPayload) Args() map[string]string {
+	return map[string]string{"room": p.Room}
+}
+
+// HistoryRequestPayload - Payload of a history frame sent by the client
+type HistoryRequestPayload struct {
+	// Count - Number of messages wanted, the server's default if empty
+	Count string `json:"count,omitempty"`
+}
+
+// Args - Returns the count argument if one was given
+func (p HistoryRequestPayload) Args() map[string]string {
+	if p.Count == "" {
+		return map[string]string{}
+	}
+	return map[string]string{"count": p.Count}
+}
+
+// SearchPayload - Payload of a search frame
+type SearchPayload struct {
+	Query string `json:"query"`
+}
+
+// Args - Returns the query argument
+func (p SearchPayload) Args() map[string]string {
+	return map[string]string{"query": p.Query}
+}
+
+// EmptyPayload - Payload of command frames without arguments, such as rooms, logout and help
+type EmptyPayload struct{}
+
+// Args - Returns no arguments
+func (p EmptyPayload) Args() map[string]string {
+	return map[string]string{}
+}
+
+// ChatPayload - Payload of a chat frame
+// This is the only representation of a user's message sent to other clients; it never carries credentials
+type ChatPayload struct {
+	// ID - Identifier assigned when the server recorded the message
+	ID string `json:"id,omitempty"`
+	// From - Handle of the sender
+	From string `json:"from"`
+	// Room - Room the message was sent to, empty for direct messages
+	Room string `json:"room,omitempty"`
+	// To - Recipient of a direct message, empty for room messages
+	To string `json:"to,omitempty"`
+	// Message - Text of the message
+	Message string `json:"message"`
+	// Sent - Time the server accepted the message
+	Sent time.Time `json:"sent"`
+	// Edited - Time the message was last edited, if it has been
+	Edited *time.Time `json:"edited,omitempty"`
+	// ReplyTo - ID of the message this message replies to, if any
+	ReplyTo string `json:"replyTo,omitempty"`
+	// Thread - ID of the message that began the thread this reply belongs to
+	Thread string `json:"thread,omitempty"`
+	// Quote - First line of the message replied to, as it read when the reply was sent
+	Quote *QuotePayload `json:"quote,omitempty"`
+	// Reactions - Emoji users reacted to the message with, in the order they were first used
+	Reactions []ReactionPayload `json:"reactions,omitempty"`
+}
+
+// QuotePayload - Excerpt of a message quoted by a reply
+type QuotePayload struct {
+	// From - Handle of the sender of the quoted message
+	From string `json:"from"`
+	// Text - First line of the quoted message
+	Text string `json:"text"`
+}
+
+// ReactionPayload - Users who reacted to a message with one emoji
+type ReactionPayload struct {
+	// Emoji - Emoji the users reacted with
+	Emoji string `json:"emoji"`
+	// Count - Number of users who reacted with Emoji
+	Count int `json:"count"`
+	// By - Handles of the users who reacted, in the order they reacted
+	By []string `json:"by"`
+}
+
+// DeletedPayload - Payload of a deleted frame
+type DeletedPayload struct {
+	// ID - Identifier of the deleted message
+	ID string `json:"id"`
+	// Room - Room the message was sent to, empty for direct messages
+	Room string `json:"room,omitempty"`
+	// To - Recipient of a direct message, empty for room messages
+	To string `json:"to,omitempty"`
+	// By - Handle of the user who deleted the message
+	By string `json:"by"`
+}
+
+// ReactionsPayload - Payload of a reactions frame
+type ReactionsPayload struct {
+	// ID - Identifier of the message reacted to
+	ID string `json:"id"`
+	// Room - Room the message was sent to, empty for direct messages
+	Room string `json:"room,omitempty"`
+	// To - Recipient of a direct message, empty for room messages
+	To string `json:"to,omitempty"`
+	// Reactions - Every reaction the message now has
+	Reactions []ReactionPayload `json:"reactions"`
+}
+
+// ThreadPayload - Payload of a thread frame sent by the server
+type ThreadPayload struct {
+	// ID - ID of the message that began the thread
+	ID string `json:"id"`
+	// Messages - The message that began the thread followed by its replies, oldest first
+	Messages []ChatPayload `json:"messages"`
+}
+
+// HistoryPayload - Payload of a history frame
+type HistoryPayload struct {
+	// Messages - Recorded messages, oldest first
+	Messages []ChatPayload `json:"messages"`
+}
+
+// SearchResultsPayload - Payload of a search_results frame
+type SearchResultsPayload struct {
+	// Query - Query the results match
+	Query string `json:"query"`
+	// Page - Page of results in Messages, starting at 1
+	Page int `json:"page"`
+	// Pages - Number of pages of results
+	Pages int `json:"pages"`
+	// Total - Number of matching messages
+	Total int `json:"total"`
+	// Messages - Matching messages on this page, newest first
+	Messages []ChatPayload `json:"messages"`
+}
+
+// NoticePayload - Payload of a notice frame
+type NoticePayload struct {
+	// Room - Room the notice concerns, if any
+	Room string `json:"room,omitempty"`
+	// Message - Text of the notice
+	Message string `json:"message"`
+}
+
+// ErrorPayload - Payload of an error frame
+type ErrorPayload struct {
+	// Code - Machine readable reason the request failed
+	Code string `json:"code"`
+	// Message - Human readable description of the failure
+	Message string `json:"message"`
+}
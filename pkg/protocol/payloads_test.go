@@ -0,0 +1,81 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestClientPayloadsMatchCommands - Typed payloads the client sends must carry exactly the arguments declared in Commands
+func TestClientPayloadsMatchCommands(t *testing.T) {
+	cases := []struct {
+		command string
+		payload interface{}
+	}{
+		{"login", CredentialsPayload{Handle: "beth", Pass: "secret"}},
+		{"newuser", CredentialsPayload{Handle: "beth", Pass: "secret"}},
+		{"resume", ResumePayload{Token: "token"}},
+		{"join", RoomPayload{Room: "lobby"}},
+		{"leave", RoomPayload{Room: "lobby"}},
+	}
+	for _, c := range cases {
+		data, err := json.Marshal(c.payload)
+		if err != nil {
+			t.Fatalf("%s: marshal returned error: %v", c.command, err)
+		}
+		var args map[string]string
+		if err := json.Unmarshal(data, &args); err != nil {
+			t.Fatalf("%s: payload is not an object of strings: %v", c.command, err)
+		}
+		if err := ValidateArgs(c.command, args); err != nil {
+			t.Errorf("%s: payload %s fails validation: %v", c.command, data, err)
+		}
+		if len(args) != len(Commands[c.command]) {
+			t.Errorf("%s: payload has fields %v, Commands declares %v", c.command, args, Commands[c.command])
+		}
+	}
+}
+
+// TestCommandPayloadsMatchCommands - Every command has a typed payload that carries exactly the arguments declared in Commands
+func TestCommandPayloadsMatchCommands(t *testing.T) {
+	if len(commandPayloads) != len(Commands) {
+		t.Errorf("%d command payloads for %d commands", len(commandPayloads), len(Commands))
+	}
+	for name, args := range Commands {
+		payload, ok := NewCommandPayload(name)
+		if !ok {
+			t.Errorf("%s: no typed payload", name)
+			continue
+		}
+		// A frame as ParseLine builds it, with every argument set
+		sent := make(map[string]string)
+		for _, arg := range args {
+			sent[arg.Name] = arg.Name + " value"
+		}
+		frame, err := NewEnvelope(name, sent)
+		if err != nil {
+			t.Fatalf("%s: NewEnvelope returned error: %v", name, err)
+		}
+		if err := frame.Decode(payload); err != nil {
+			t.Errorf("%s: Decode returned error: %v", name, err)
+			continue
+		}
+		received := payload.Args()
+		if len(received) != len(sent) {
+			t.Errorf("%s: payload returned arguments %v, want %v", name, received, sent)
+		}
+		for key, value := range sent {
+			if received[key] != value {
+				t.Errorf("%s: argument %s is %q, want %q", name, key, received[key], value)
+			}
+		}
+	}
+}
+
+// TestCommandPayloadsRejectMistypedArguments - Arguments that are not strings fail to decode
+func TestCommandPayloadsRejectMistypedArguments(t *testing.T) {
+	payload, _ := NewCommandPayload("history")
+	frame := Envelope{Type: "history", Payload: json.RawMessage(`{"count": 5}`)}
+	if err := frame.Decode(payload); err == nil {
+		t.Errorf("Decoded a numeric count into %+v", payload)
+	}
+}
@@ -0,0 +1,188 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// entry - Indexed message and the order it was added in
+type entry struct {
+	position int
+	message  protocol.ChatPayload
+}
+
+// Index - Inverted index from the words of recorded messages to the messages containing them
+type Index struct {
+	mutex    sync.RWMutex
+	postings map[string]map[string]bool
+	entries  map[string]entry
+	added    int
+}
+
+// NewIndex - Create an empty index
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]bool),
+		entries:  make(map[string]entry),
+	}
+}
+
+// Terms - Split text into the lowercase words it is indexed under
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Add - Index message under the words of its text
+// Messages without an ID cannot be indexed and are ignored
+func (ix *Index) Add(message protocol.ChatPayload) {
+	if message.ID == "" {
+		return
+	}
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	ix.added++
+	ix.entries[message.ID] = entry{position: ix.added, message: message}
+	ix.index(message)
+}
+
+// Update - Reindex message under the words of its new text, keeping its place in the results
+func (ix *Index) Update(message protocol.ChatPayload) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	old, ok := ix.entries[message.ID]
+	if !ok {
+		return
+	}
+	ix.unindex(old.message)
+	ix.entries[message.ID] = entry{position: old.position, message: message}
+	ix.index(message)
+}
+
+// Remove - Remove the message with the provided ID from the index
+func (ix *Index) Remove(id string) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	old, ok := ix.entries[id]
+	if !ok {
+		return
+	}
+	ix.unindex(old.message)
+	delete(ix.entries, id)
+}
+
+// index - Add message to the postings of its words
+// The caller must hold the mutex
+func (ix *Index) index(message protocol.ChatPayload) {
+	for _, term := range Terms(message.Message) {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[string]bool)
+		}
+		ix.postings[term][message.ID] = true
+	}
+}
+
+// unindex - Remove message from the postings of its words
+// The caller must hold the mutex
+func (ix *Index) unindex(message protocol.ChatPayload) {
+	for _, term := range Terms(message.Message) {
+		delete(ix.postings[term], message.ID)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+}
+
+// Search - Returns the messages matching query and accepted by visible, newest first
+func (ix *Index) Search(query Query, visible func(protocol.ChatPayload) bool) []protocol.ChatPayload {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+
+	found := []entry{}
+	for _, id := range ix.candidates(query.Terms) {
+		e := ix.entries[id]
+		if query.matches(e.message) && visible(e.message) {
+			found = append(found, e)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].position > found[j].position })
+	messages := make([]protocol.ChatPayload, len(found))
+	for i, e := range found {
+		messages[i] = e.message
+	}
+	return messages
+}
+
+// Paginate - Returns the requested page of messages, starting at 1, and the number of pages of size messages
+// Pages before the first or past the last are empty
+func Paginate(messages []protocol.ChatPayload, page int, size int) ([]protocol.ChatPayload, int) {
+	pages := len(messages) / size
+	if len(messages)%size != 0 {
+		pages++
+	}
+	if page < 1 || page > pages {
+		return []protocol.ChatPayload{}, pages
+	}
+	// page is at most pages, so neither bound can overflow
+	start := (page - 1) * size
+	end := len(messages)
+	if len(messages)-start > size {
+		end = start + size
+	}
+	return messages[start:end], pages
+}
+
+// candidates - Returns the IDs of messages containing every term
+// Without terms every indexed message is a candidate
+// The caller must hold the mutex
+func (ix *Index) candidates(terms []string) []string {
+	ids := []string{}
+	if len(terms) == 0 {
+		for id := range ix.entries {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	// Start from the rarest term so the fewest postings are checked
+	rarest := ix.postings[terms[0]]
+	for _, term := range terms[1:] {
+		if len(ix.postings[term]) < len(rarest) {
+			rarest = ix.postings[term]
+		}
+	}
+	for id := range rarest {
+		all := true
+		for _, term := range terms {
+			if !ix.postings[term][id] {
+				all = false
+				break
+			}
+		}
+		if all {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// matches - Evaluates if message passes the query's filters
+func (q Query) matches(message protocol.ChatPayload) bool {
+	if q.From != "" && !strings.EqualFold(q.From, message.From) {
+		return false
+	}
+	if q.Room != "" && q.Room != message.Room {
+		return false
+	}
+	if !q.Before.IsZero() && !message.Sent.Before(q.Before) {
+		return false
+	}
+	if !q.After.IsZero() && message.Sent.Before(q.After) {
+		return false
+	}
+	return true
+}
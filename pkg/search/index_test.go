@@ -0,0 +1,65 @@
+package search
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+func numberedMessages(n int) []protocol.ChatPayload {
+	messages := make([]protocol.ChatPayload, n)
+	for i := range messages {
+		messages[i] = protocol.ChatPayload{ID: strconv.Itoa(i + 1)}
+	}
+	return messages
+}
+
+func TestPaginate(t *testing.T) {
+	messages := numberedMessages(25)
+	cases := []struct {
+		page      int
+		wantLen   int
+		wantFirst string
+	}{
+		{page: 1, wantLen: 10, wantFirst: "1"},
+		{page: 2, wantLen: 10, wantFirst: "11"},
+		{page: 3, wantLen: 5, wantFirst: "21"},
+		{page: 4, wantLen: 0},
+		{page: 0, wantLen: 0},
+	}
+	for _, c := range cases {
+		page, pages := Paginate(messages, c.page, 10)
+		if pages != 3 {
+			t.Errorf("Paginate(page %d) pages = %d, want 3", c.page, pages)
+		}
+		if len(page) != c.wantLen {
+			t.Errorf("Paginate(page %d) returned %d messages, want %d", c.page, len(page), c.wantLen)
+		}
+		if c.wantLen > 0 && page[0].ID != c.wantFirst {
+			t.Errorf("Paginate(page %d) starts at %s, want %s", c.page, page[0].ID, c.wantFirst)
+		}
+	}
+}
+
+func TestPaginateVeryLargePage(t *testing.T) {
+	messages := numberedMessages(25)
+	maxInt := int(^uint(0) >> 1)
+	for _, page := range []int{maxInt/10 + 1, maxInt - 1, maxInt} {
+		found, pages := Paginate(messages, page, 10)
+		if len(found) != 0 || pages != 3 {
+			t.Errorf("Paginate(page %d) = %d messages, %d pages; want 0 messages, 3 pages", page, len(found), pages)
+		}
+	}
+}
+
+func TestParseQueryVeryLargePage(t *testing.T) {
+	query, err := ParseQuery("x page:" + strconv.Itoa(int(^uint(0)>>1)/10+1))
+	if err != nil {
+		t.Fatalf("ParseQuery returned error: %v", err)
+	}
+	found, _ := Paginate(numberedMessages(3), query.Page, 10)
+	if len(found) != 0 {
+		t.Errorf("Paginate returned %d messages for page %d, want none", len(found), query.Page)
+	}
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/masonflint44/websocketLab/pkg/helpers"
+)
+
+// dateLayouts - Formats accepted by the before: and after: filters
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// ErrEmptyQuery - Returned when a query has neither words nor filters
+var ErrEmptyQuery = errors.New("Search needs words or filters")
+
+// Query - Words and filters a message must match
+type Query struct {
+	// Terms - Words the message must contain
+	Terms []string
+	// From - Handle of the sender, if set
+	From string
+	// Room - Room the message was sent to, if set
+	Room string
+	// Before - Message must have been sent before this time, if set
+	Before time.Time
+	// After - Message must have been sent at or after this time, if set
+	After time.Time
+	// Page - Page of results to return, starting at 1
+	Page int
+}
+
+// ParseQuery - Parse a query such as "deploy from:beth room:ops after:2019-04-01 page:2"
+// Dates are read as UTC and may be written as 2006-01-02, 2006-01-02T15:04 or RFC 3339
+func ParseQuery(text string) (Query, error) {
+	query := Query{Page: 1}
+	filtered := false
+	for _, field := range strings.Fields(text) {
+		name, value := helpers.SplitOnFirstDelim(':', field)
+		if value == "" {
+			query.Terms = append(query.Terms, Terms(field)...)
+			continue
+		}
+		var err error
+		switch name = strings.ToLower(name); name {
+		case "from":
+			query.From = value
+		case "room":
+			query.Room = value
+		case "before":
+			query.Before, err = parseDate(value)
+		case "after":
+			query.After, err = parseDate(value)
+		case "page":
+			query.Page, err = strconv.Atoi(value)
+			if err == nil && query.Page < 1 {
+				err = errors.New("Page must be at least 1")
+			}
+		default:
+			query.Terms = append(query.Terms, Terms(field)...)
+			continue
+		}
+		if err != nil {
+			return Query{}, fmt.Errorf("Invalid %s filter - %v", name, err)
+		}
+		filtered = filtered || name != "page"
+	}
+	if len(query.Terms) == 0 && !filtered {
+		return Query{}, ErrEmptyQuery
+	}
+	return query, nil
+}
+
+// parseDate - Parse a date or time in one of dateLayouts
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date such as 2006-01-02", value)
+}
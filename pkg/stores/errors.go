@@ -0,0 +1,31 @@
+package stores
+
+import "errors"
+
+// ErrHandleTaken - Returned when creating a user whose handle is already registered
+var ErrHandleTaken = errors.New("Handle is not unique")
+
+// ErrInvalidHandle - Returned when creating a user whose handle has characters other than letters, digits, '_' and '-'
+// Such a handle could contain the file store's delimiter or be trimmed into another user's handle
+var ErrInvalidHandle = errors.New("Handle is not valid")
+
+// ErrUnknownHandle - Returned when deleting a user that is not registered
+var ErrUnknownHandle = errors.New("Handle is not registered")
+
+// ErrUnknownSession - Returned when a session token was never issued or has been revoked
+var ErrUnknownSession = errors.New("Session is not recognized")
+
+// ErrSessionExpired - Returned when a session token has gone unused for too long
+var ErrSessionExpired = errors.New("Session has expired")
+
+// ErrUnknownMessage - Returned when a message was never recorded or has been deleted
+var ErrUnknownMessage = errors.New("Message is not recorded")
+
+// ErrAlreadyReacted - Returned when a user reacts to a message with an emoji they already reacted with
+var ErrAlreadyReacted = errors.New("Reaction is already recorded")
+
+// ErrNotReacted - Returned when removing a reaction the user never made
+var ErrNotReacted = errors.New("Reaction is not recorded")
+
+// ErrTooManyReactions - Returned when reacting with a new emoji to a message that already has as many different emoji as allowed
+var ErrTooManyReactions = errors.New("Message has too many different reactions")
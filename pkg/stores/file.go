@@ -0,0 +1,195 @@
+package stores
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/masonflint44/websocketLab/pkg/credentials"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// FileUserStore - UserStore backed by a file of handle,hash lines
+type FileUserStore struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// NewFileUserStore - Create a user store backed by the file at path
+// The file is created on first registration if it does not exist
+func NewFileUserStore(path string) *FileUserStore {
+	return &FileUserStore{path: path}
+}
+
+// Create - Register a new user with the provided credentials
+func (s *FileUserStore) Create(handle string, pass string) error {
+	if !protocol.ValidHandle(handle) {
+		return ErrInvalidHandle
+	}
+	hash, err := credentials.Hash(pass)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok, err := s.find(handle)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrHandleTaken
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+	_, err = writer.WriteString("\n" + handle + "," + hash)
+	return err
+}
+
+// Lookup - Evaluates if a user with the provided handle is registered
+func (s *FileUserStore) Lookup(handle string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok, err := s.find(handle)
+	return ok, err
+}
+
+// Verify - Evaluates if the provided credentials match a registered user
+// Legacy plaintext rows are replaced with a hash after the first successful verification
+func (s *FileUserStore) Verify(handle string, pass string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, found, err := s.find(handle)
+	if err != nil || !found {
+		return false, err
+	}
+	ok, err := credentials.Verify(stored, pass)
+	if err != nil || !ok {
+		return false, err
+	}
+	if credentials.NeedsRehash(stored) {
+		if err := s.rehash(handle, pass); err != nil {
+			log.Println("Unable to upgrade password hash for", handle, "-", err)
+		}
+	}
+	return true, nil
+}
+
+// Delete - Remove the user with the provided handle
+func (s *FileUserStore) Delete(handle string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lines, err := s.readLines()
+	if err != nil {
+		return err
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		if lineHandle, _ := splitRow(line); lineHandle != handle {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		return ErrUnknownHandle
+	}
+	return s.writeLines(kept)
+}
+
+// List - Returns the handles of all registered users
+func (s *FileUserStore) List() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lines, err := s.readLines()
+	if err != nil {
+		return nil, err
+	}
+	handles := []string{}
+	for _, line := range lines {
+		if handle, _ := splitRow(line); handle != "" {
+			handles = append(handles, handle)
+		}
+	}
+	return handles, nil
+}
+
+// find - Returns the stored credentials for handle
+func (s *FileUserStore) find(handle string) (string, bool, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", false, err
+		}
+		lineHandle, stored := splitRow(strings.TrimSuffix(line, "\n"))
+		if lineHandle != "" && lineHandle == handle {
+			return stored, true, nil
+		}
+		if err == io.EOF {
+			return "", false, nil
+		}
+	}
+}
+
+// rehash - Replace the stored credentials for handle with a hash using the current parameters
+func (s *FileUserStore) rehash(handle string, pass string) error {
+	hash, err := credentials.Hash(pass)
+	if err != nil {
+		return err
+	}
+	lines, err := s.readLines()
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		if lineHandle, _ := splitRow(line); lineHandle == handle {
+			lines[i] = handle + "," + hash
+		}
+	}
+	return s.writeLines(lines)
+}
+
+// splitRow - Splits a handle,hash row at its first comma
+// Neither part is trimmed, so a handle only matches the row it was stored as
+func splitRow(line string) (string, string) {
+	handle, hash, _ := strings.Cut(line, ",")
+	return handle, hash
+}
+
+// readLines - Returns every line of the backing file
+func (s *FileUserStore) readLines() ([]string, error) {
+	contents, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(contents), "\n"), nil
+}
+
+// writeLines - Replace the backing file with lines
+// Writes to a temporary file first so a failed write cannot truncate the store
+func (s *FileUserStore) writeLines(lines []string) error {
+	tmp := s.path + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
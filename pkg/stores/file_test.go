@@ -0,0 +1,31 @@
+package stores
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileUserStoreMatchesHandlesExactly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	// Rows left by a store that trimmed handles when matching them
+	rows := "\nServer ,secret\nbeth\r,secret"
+	if err := ioutil.WriteFile(path, []byte(rows), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileUserStore(path)
+	for _, handle := range []string{"Server", "beth"} {
+		if ok, err := store.Lookup(handle); err != nil || ok {
+			t.Errorf("Lookup(%s) = %t, %v, want false", handle, ok, err)
+		}
+		if ok, err := store.Verify(handle, "secret"); err != nil || ok {
+			t.Errorf("Verify(%s) = %t, %v, want false", handle, ok, err)
+		}
+	}
+	if err := store.Create("beth", "secret"); err != nil {
+		t.Fatalf("Create(beth) returned error: %v", err)
+	}
+	if ok, err := store.Verify("beth", "secret"); err != nil || !ok {
+		t.Errorf("Verify(beth) = %t, %v, want true", ok, err)
+	}
+}
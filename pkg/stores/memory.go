@@ -0,0 +1,80 @@
+package stores
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/masonflint44/websocketLab/pkg/credentials"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// MemoryUserStore - UserStore that keeps users in memory, intended for tests and throwaway servers
+type MemoryUserStore struct {
+	mutex sync.RWMutex
+	users map[string]string
+}
+
+// NewMemoryUserStore - Create an empty in-memory user store
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[string]string)}
+}
+
+// Create - Register a new user with the provided credentials
+func (s *MemoryUserStore) Create(handle string, pass string) error {
+	if !protocol.ValidHandle(handle) {
+		return ErrInvalidHandle
+	}
+	hash, err := credentials.Hash(pass)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.users[handle]; ok {
+		return ErrHandleTaken
+	}
+	s.users[handle] = hash
+	return nil
+}
+
+// Lookup - Evaluates if a user with the provided handle is registered
+func (s *MemoryUserStore) Lookup(handle string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.users[handle]
+	return ok, nil
+}
+
+// Verify - Evaluates if the provided credentials match a registered user
+func (s *MemoryUserStore) Verify(handle string, pass string) (bool, error) {
+	s.mutex.RLock()
+	stored, ok := s.users[handle]
+	s.mutex.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return credentials.Verify(stored, pass)
+}
+
+// Delete - Remove the user with the provided handle
+func (s *MemoryUserStore) Delete(handle string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.users[handle]; !ok {
+		return ErrUnknownHandle
+	}
+	delete(s.users, handle)
+	return nil
+}
+
+// List - Returns the handles of all registered users
+func (s *MemoryUserStore) List() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	handles := make([]string, 0, len(s.users))
+	for handle := range s.users {
+		handles = append(handles, handle)
+	}
+	sort.Strings(handles)
+	return handles, nil
+}
@@ -0,0 +1,166 @@
+package stores
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// FileMessageStore - MessageStore backed by an append-only file of JSON lines
+// The history is read into memory when the store is opened and every change is appended to the file
+// Edits append the updated message and deletions append a record marking the message deleted
+type FileMessageStore struct {
+	mutex sync.RWMutex
+	path  string
+	log   *messageLog
+	next  int
+}
+
+// NewFileMessageStore - Create a message store backed by the file at path
+// The file is created on the first message if it does not exist
+func NewFileMessageStore(path string) (*FileMessageStore, error) {
+	s := &FileMessageStore{path: path, log: newMessageLog(), next: 1}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Records are read whole whatever their length, so a large message cannot stop the history from loading
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var record messageRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return nil, fmt.Errorf("Invalid message on line %d of %s: %v", line, path, err)
+			}
+			if id, err := strconv.Atoi(record.ID); err == nil && id >= s.next {
+				s.next = id + 1
+			}
+			s.log.apply(record)
+		}
+		if err == io.EOF {
+			return s, nil
+		}
+	}
+}
+
+// Append - Record message, assigning it an ID, and return the recorded message
+func (s *FileMessageStore) Append(message protocol.ChatPayload) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message.ID = strconv.Itoa(s.next)
+	if err := s.write(messageRecord{ChatPayload: message}); err != nil {
+		return message, err
+	}
+	s.next++
+	return message, nil
+}
+
+// Get - Returns the message with the provided ID
+func (s *FileMessageStore) Get(id string) (protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.get(id)
+}
+
+// Edit - Replace the text of the message with the provided ID, marking it edited, and return the updated message
+func (s *FileMessageStore) Edit(id string, text string) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.edit(id, text, time.Now().UTC())
+	if err != nil {
+		return message, err
+	}
+	return message, s.write(messageRecord{ChatPayload: message})
+}
+
+// Delete - Remove the message with the provided ID
+func (s *FileMessageStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.get(id)
+	if err != nil {
+		return err
+	}
+	return s.write(messageRecord{ChatPayload: protocol.ChatPayload{ID: message.ID}, Deleted: true})
+}
+
+// React - Record handle's reaction with emoji to the message with the provided ID and return the updated message
+// A new emoji is refused once the message has limit different emoji
+func (s *FileMessageStore) React(id string, emoji string, handle string, limit int) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.react(id, emoji, handle, true, limit)
+	if err != nil {
+		return message, err
+	}
+	return message, s.write(messageRecord{ChatPayload: message})
+}
+
+// Unreact - Remove handle's reaction with emoji from the message with the provided ID and return the updated message
+func (s *FileMessageStore) Unreact(id string, emoji string, handle string) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.react(id, emoji, handle, false, 0)
+	if err != nil {
+		return message, err
+	}
+	return message, s.write(messageRecord{ChatPayload: message})
+}
+
+// Thread - Returns the thread the message with the provided ID belongs to
+// The message that began the thread comes first, followed by its replies oldest first
+func (s *FileMessageStore) Thread(id string) ([]protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.thread(id)
+}
+
+// All - Returns every recorded message, oldest first
+func (s *FileMessageStore) All() ([]protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.all(), nil
+}
+
+// Recent - Returns up to n of the most recent messages accepted by visible, oldest first
+func (s *FileMessageStore) Recent(n int, visible func(protocol.ChatPayload) bool) ([]protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.recent(n, visible), nil
+}
+
+// write - Append record to the file and apply it to the log
+// The caller must hold the mutex
+func (s *FileMessageStore) write(record messageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.log.apply(record)
+	return nil
+}
@@ -0,0 +1,163 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// messageRecord - Line of a message log
+// A later record with the same ID replaces an earlier one, and a deleted record removes the message
+type messageRecord struct {
+	protocol.ChatPayload
+	// Deleted - Message was deleted
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// messageLog - Recorded messages in the order they were sent, shared by the message stores
+// It is not safe for concurrent use; the stores guard it with their mutex
+type messageLog struct {
+	messages  []protocol.ChatPayload
+	positions map[string]int
+	deleted   map[string]bool
+	threads   map[string][]string
+}
+
+// newMessageLog - Create an empty message log
+func newMessageLog() *messageLog {
+	return &messageLog{
+		positions: make(map[string]int),
+		deleted:   make(map[string]bool),
+		threads:   make(map[string][]string),
+	}
+}
+
+// apply - Add, replace or delete the message described by record
+func (l *messageLog) apply(record messageRecord) {
+	position, ok := l.positions[record.ID]
+	switch {
+	case record.Deleted:
+		if ok {
+			l.deleted[record.ID] = true
+		}
+	case ok:
+		l.messages[position] = record.ChatPayload
+	default:
+		l.positions[record.ID] = len(l.messages)
+		l.messages = append(l.messages, record.ChatPayload)
+		if record.Thread != "" {
+			l.threads[record.Thread] = append(l.threads[record.Thread], record.ID)
+		}
+	}
+}
+
+// get - Returns the message with the provided ID
+func (l *messageLog) get(id string) (protocol.ChatPayload, error) {
+	position, ok := l.positions[id]
+	if !ok || l.deleted[id] {
+		return protocol.ChatPayload{}, ErrUnknownMessage
+	}
+	return l.messages[position], nil
+}
+
+// edit - Returns the message with the provided ID with its text replaced and marked as edited at the provided time
+// The log is left unchanged so the caller can record the result
+func (l *messageLog) edit(id string, text string, at time.Time) (protocol.ChatPayload, error) {
+	message, err := l.get(id)
+	if err != nil {
+		return message, err
+	}
+	message.Message = text
+	message.Edited = &at
+	return message, nil
+}
+
+// react - Returns the message with the provided ID with handle's reaction with emoji added or removed
+// Adding a new emoji fails once the message has limit different emoji
+// The log is left unchanged so the caller can record the result
+func (l *messageLog) react(id string, emoji string, handle string, add bool, limit int) (protocol.ChatPayload, error) {
+	message, err := l.get(id)
+	if err != nil {
+		return message, err
+	}
+	found := false
+	reactions := []protocol.ReactionPayload{}
+	for _, reaction := range message.Reactions {
+		if reaction.Emoji != emoji {
+			reactions = append(reactions, reaction)
+			continue
+		}
+		found = true
+		by := []string{}
+		for _, reactor := range reaction.By {
+			if reactor == handle {
+				if add {
+					return message, ErrAlreadyReacted
+				}
+				continue
+			}
+			by = append(by, reactor)
+		}
+		if add {
+			by = append(by, handle)
+		} else if len(by) == len(reaction.By) {
+			return message, ErrNotReacted
+		}
+		if len(by) > 0 {
+			reactions = append(reactions, protocol.ReactionPayload{Emoji: emoji, Count: len(by), By: by})
+		}
+	}
+	if !found {
+		if !add {
+			return message, ErrNotReacted
+		}
+		if len(message.Reactions) >= limit {
+			return message, ErrTooManyReactions
+		}
+		reactions = append(reactions, protocol.ReactionPayload{Emoji: emoji, Count: 1, By: []string{handle}})
+	}
+	message.Reactions = reactions
+	if len(reactions) == 0 {
+		message.Reactions = nil
+	}
+	return message, nil
+}
+
+// thread - Returns the message that began the thread of the message with the provided ID followed by its replies
+// Deleted messages are left out
+func (l *messageLog) thread(id string) ([]protocol.ChatPayload, error) {
+	message, err := l.get(id)
+	if err != nil {
+		return nil, err
+	}
+	root := message.ID
+	if message.Thread != "" {
+		root = message.Thread
+	}
+	found := []protocol.ChatPayload{}
+	for _, member := range append([]string{root}, l.threads[root]...) {
+		if m, err := l.get(member); err == nil {
+			found = append(found, m)
+		}
+	}
+	return found, nil
+}
+
+// all - Returns every message that has not been deleted, oldest first
+func (l *messageLog) all() []protocol.ChatPayload {
+	return l.recent(len(l.messages), func(protocol.ChatPayload) bool { return true })
+}
+
+// recent - Returns up to n of the last messages accepted by visible, oldest first
+func (l *messageLog) recent(n int, visible func(protocol.ChatPayload) bool) []protocol.ChatPayload {
+	found := []protocol.ChatPayload{}
+	for i := len(l.messages) - 1; i >= 0 && len(found) < n; i-- {
+		if !l.deleted[l.messages[i].ID] && visible(l.messages[i]) {
+			found = append(found, l.messages[i])
+		}
+	}
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found
+}
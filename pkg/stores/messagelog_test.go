@@ -0,0 +1,121 @@
+package stores
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/masonflint44/websocketLab/pkg/interfaces"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+func messageStores(t *testing.T) map[string]interfaces.MessageStore {
+	file, err := NewFileMessageStore(filepath.Join(t.TempDir(), "messages.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFileMessageStore returned error: %v", err)
+	}
+	return map[string]interfaces.MessageStore{
+		"memory": NewMemoryMessageStore(),
+		"file":   file,
+	}
+}
+
+func TestReactLimitUnderConcurrency(t *testing.T) {
+	for name, store := range messageStores(t) {
+		t.Run(name, func(t *testing.T) {
+			message, err := store.Append(protocol.ChatPayload{From: "beth", Room: "lobby", Message: "hi"})
+			if err != nil {
+				t.Fatalf("Append returned error: %v", err)
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, err := store.React(message.ID, fmt.Sprintf("e%d", i), "beth", 20)
+					if err != nil && err != ErrTooManyReactions {
+						t.Errorf("React returned error: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			got, err := store.Get(message.ID)
+			if err != nil {
+				t.Fatalf("Get returned error: %v", err)
+			}
+			if len(got.Reactions) != 20 {
+				t.Errorf("message has %d different reactions, want 20", len(got.Reactions))
+			}
+		})
+	}
+}
+
+func TestEditKeepsConcurrentReactions(t *testing.T) {
+	for name, store := range messageStores(t) {
+		t.Run(name, func(t *testing.T) {
+			message, err := store.Append(protocol.ChatPayload{From: "beth", Room: "lobby", Message: "hi"})
+			if err != nil {
+				t.Fatalf("Append returned error: %v", err)
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					if _, err := store.React(message.ID, "👍", fmt.Sprintf("user%d", i), 20); err != nil {
+						t.Errorf("React returned error: %v", err)
+					}
+				}(i)
+				go func(i int) {
+					defer wg.Done()
+					if _, err := store.Edit(message.ID, fmt.Sprintf("edit %d", i)); err != nil {
+						t.Errorf("Edit returned error: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			got, err := store.Get(message.ID)
+			if err != nil {
+				t.Fatalf("Get returned error: %v", err)
+			}
+			if len(got.Reactions) != 1 || got.Reactions[0].Count != 20 {
+				t.Errorf("reactions = %+v, want 👍 from 20 users", got.Reactions)
+			}
+			if got.Edited == nil {
+				t.Error("message is not marked as edited")
+			}
+		})
+	}
+}
+
+func TestFileMessageStoreReopensLargeMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	store, err := NewFileMessageStore(path)
+	if err != nil {
+		t.Fatalf("NewFileMessageStore returned error: %v", err)
+	}
+	// Larger than the buffer a line scanner allows by default or was given before
+	text := strings.Repeat("x", 2*1024*1024)
+	message, err := store.Append(protocol.ChatPayload{From: "beth", Room: "lobby", Message: text})
+	if err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	if _, err := store.Append(protocol.ChatPayload{From: "beth", Room: "lobby", Message: "after"}); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+
+	reopened, err := NewFileMessageStore(path)
+	if err != nil {
+		t.Fatalf("Reopening the store returned error: %v", err)
+	}
+	got, err := reopened.Get(message.ID)
+	if err != nil || got.Message != text {
+		t.Errorf("Get(%s) returned %d bytes, %v, want %d bytes", message.ID, len(got.Message), err, len(text))
+	}
+	next, err := reopened.Append(protocol.ChatPayload{From: "beth", Room: "lobby", Message: "next"})
+	if err != nil || next.ID != "3" {
+		t.Errorf("Append after reopening assigned ID %q, %v, want 3", next.ID, err)
+	}
+}
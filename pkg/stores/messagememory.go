@@ -0,0 +1,109 @@
+package stores
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// MemoryMessageStore - MessageStore that keeps messages in memory, intended for tests and throwaway servers
+type MemoryMessageStore struct {
+	mutex sync.RWMutex
+	log   *messageLog
+	next  int
+}
+
+// NewMemoryMessageStore - Create an empty in-memory message store
+func NewMemoryMessageStore() *MemoryMessageStore {
+	return &MemoryMessageStore{log: newMessageLog(), next: 1}
+}
+
+// Append - Record message, assigning it an ID, and return the recorded message
+func (s *MemoryMessageStore) Append(message protocol.ChatPayload) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message.ID = strconv.Itoa(s.next)
+	s.next++
+	s.log.apply(messageRecord{ChatPayload: message})
+	return message, nil
+}
+
+// Get - Returns the message with the provided ID
+func (s *MemoryMessageStore) Get(id string) (protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.get(id)
+}
+
+// Edit - Replace the text of the message with the provided ID, marking it edited, and return the updated message
+func (s *MemoryMessageStore) Edit(id string, text string) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.edit(id, text, time.Now().UTC())
+	if err != nil {
+		return message, err
+	}
+	s.log.apply(messageRecord{ChatPayload: message})
+	return message, nil
+}
+
+// Delete - Remove the message with the provided ID
+func (s *MemoryMessageStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.get(id)
+	if err != nil {
+		return err
+	}
+	s.log.apply(messageRecord{ChatPayload: message, Deleted: true})
+	return nil
+}
+
+// React - Record handle's reaction with emoji to the message with the provided ID and return the updated message
+// A new emoji is refused once the message has limit different emoji
+func (s *MemoryMessageStore) React(id string, emoji string, handle string, limit int) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.react(id, emoji, handle, true, limit)
+	if err != nil {
+		return message, err
+	}
+	s.log.apply(messageRecord{ChatPayload: message})
+	return message, nil
+}
+
+// Unreact - Remove handle's reaction with emoji from the message with the provided ID and return the updated message
+func (s *MemoryMessageStore) Unreact(id string, emoji string, handle string) (protocol.ChatPayload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message, err := s.log.react(id, emoji, handle, false, 0)
+	if err != nil {
+		return message, err
+	}
+	s.log.apply(messageRecord{ChatPayload: message})
+	return message, nil
+}
+
+// Thread - Returns the thread the message with the provided ID belongs to
+// The message that began the thread comes first, followed by its replies oldest first
+func (s *MemoryMessageStore) Thread(id string) ([]protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.thread(id)
+}
+
+// All - Returns every recorded message, oldest first
+func (s *MemoryMessageStore) All() ([]protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.all(), nil
+}
+
+// Recent - Returns up to n of the most recent messages accepted by visible, oldest first
+func (s *MemoryMessageStore) Recent(n int, visible func(protocol.ChatPayload) bool) ([]protocol.ChatPayload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.log.recent(n, visible), nil
+}
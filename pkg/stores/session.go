@@ -0,0 +1,119 @@
+package stores
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// tokenLen - Random bytes in a session token
+const tokenLen = 32
+
+// session - State kept for an issued session token
+type session struct {
+	handle   string
+	lastSeen time.Time
+}
+
+// MemorySessionStore - SessionStore that keeps sessions in memory
+// Sessions expire once unused for longer than the store's ttl and do not survive a restart
+type MemorySessionStore struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*session
+}
+
+// NewMemorySessionStore - Create an empty session store whose sessions expire after ttl without use
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		ttl:      ttl,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Issue - Start a session for the user with the provided handle and return its token
+func (s *MemorySessionStore) Issue(handle string) (string, error) {
+	raw := make([]byte, tokenLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sweep(now)
+	s.sessions[token] = &session{handle: handle, lastSeen: now}
+	return token, nil
+}
+
+// Resume - Returns the handle of the unexpired session identified by token and records it as seen
+func (s *MemorySessionStore) Resume(token string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sess, err := s.lookup(token, time.Now())
+	if err != nil {
+		return "", err
+	}
+	sess.lastSeen = time.Now()
+	return sess.handle, nil
+}
+
+// Touch - Record activity on the session identified by token
+func (s *MemorySessionStore) Touch(token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sess, err := s.lookup(token, time.Now())
+	if err != nil {
+		return err
+	}
+	sess.lastSeen = time.Now()
+	return nil
+}
+
+// Expires - Returns the time the session identified by token expires if left unused
+func (s *MemorySessionStore) Expires(token string) (time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sess, err := s.lookup(token, time.Now())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sess.lastSeen.Add(s.ttl), nil
+}
+
+// Revoke - End the session identified by token
+func (s *MemorySessionStore) Revoke(token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.sessions[token]; !ok {
+		return ErrUnknownSession
+	}
+	delete(s.sessions, token)
+	return nil
+}
+
+// lookup - Returns the session identified by token, removing it if it has expired
+// The caller must hold the mutex
+func (s *MemorySessionStore) lookup(token string, now time.Time) (*session, error) {
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil, ErrUnknownSession
+	}
+	if now.Sub(sess.lastSeen) > s.ttl {
+		delete(s.sessions, token)
+		return nil, ErrSessionExpired
+	}
+	return sess, nil
+}
+
+// sweep - Remove every expired session
+// The caller must hold the mutex
+func (s *MemorySessionStore) sweep(now time.Time) {
+	for token, sess := range s.sessions {
+		if now.Sub(sess.lastSeen) > s.ttl {
+			delete(s.sessions, token)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package stores
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/masonflint44/websocketLab/pkg/credentials"
+	"github.com/masonflint44/websocketLab/pkg/protocol"
+)
+
+// SQLUserStore - UserStore backed by a SQL database such as an embedded SQLite file
+type SQLUserStore struct {
+	db *sql.DB
+}
+
+// NewSQLUserStore - Create a user store backed by db, creating the users table if needed
+func NewSQLUserStore(db *sql.DB) (*SQLUserStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS users (
+		handle TEXT PRIMARY KEY NOT NULL,
+		hash TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLUserStore{db: db}, nil
+}
+
+// Create - Register a new user with the provided credentials
+func (s *SQLUserStore) Create(handle string, pass string) error {
+	if !protocol.ValidHandle(handle) {
+		return ErrInvalidHandle
+	}
+	hash, err := credentials.Hash(pass)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT INTO users (handle, hash) VALUES (?, ?)", handle, hash)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
+		return ErrHandleTaken
+	}
+	return err
+}
+
+// Lookup - Evaluates if a user with the provided handle is registered
+func (s *SQLUserStore) Lookup(handle string) (bool, error) {
+	_, ok, err := s.find(handle)
+	return ok, err
+}
+
+// Verify - Evaluates if the provided credentials match a registered user
+// Hashes made with outdated parameters are replaced after the first successful verification
+func (s *SQLUserStore) Verify(handle string, pass string) (bool, error) {
+	stored, found, err := s.find(handle)
+	if err != nil || !found {
+		return false, err
+	}
+	ok, err := credentials.Verify(stored, pass)
+	if err != nil || !ok {
+		return false, err
+	}
+	if credentials.NeedsRehash(stored) {
+		if err := s.rehash(handle, pass); err != nil {
+			log.Println("Unable to upgrade password hash for", handle, "-", err)
+		}
+	}
+	return true, nil
+}
+
+// Delete - Remove the user with the provided handle
+func (s *SQLUserStore) Delete(handle string) error {
+	result, err := s.db.Exec("DELETE FROM users WHERE handle = ?", handle)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUnknownHandle
+	}
+	return nil
+}
+
+// List - Returns the handles of all registered users
+func (s *SQLUserStore) List() ([]string, error) {
+	rows, err := s.db.Query("SELECT handle FROM users ORDER BY handle")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	handles := []string{}
+	for rows.Next() {
+		var handle string
+		if err := rows.Scan(&handle); err != nil {
+			return nil, err
+		}
+		handles = append(handles, handle)
+	}
+	return handles, rows.Err()
+}
+
+// find - Returns the stored credentials for handle
+func (s *SQLUserStore) find(handle string) (string, bool, error) {
+	var stored string
+	err := s.db.QueryRow("SELECT hash FROM users WHERE handle = ?", handle).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return stored, true, nil
+}
+
+// rehash - Replace the stored credentials for handle with a hash using the current parameters
+func (s *SQLUserStore) rehash(handle string, pass string) error {
+	hash, err := credentials.Hash(pass)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("UPDATE users SET hash = ? WHERE handle = ?", hash, handle)
+	return err
+}
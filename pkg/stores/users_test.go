@@ -0,0 +1,49 @@
+package stores
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/masonflint44/websocketLab/pkg/interfaces"
+	_ "modernc.org/sqlite"
+)
+
+func userStores(t *testing.T) map[string]interfaces.UserStore {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sqlStore, err := NewSQLUserStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLUserStore returned error: %v", err)
+	}
+	return map[string]interfaces.UserStore{
+		"memory": NewMemoryUserStore(),
+		"file":   NewFileUserStore(filepath.Join(t.TempDir(), "users.txt")),
+		"sqlite": sqlStore,
+	}
+}
+
+func TestCreateRejectsInvalidHandles(t *testing.T) {
+	for name, store := range userStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, handle := range []string{"", "a,b", "a b", "a\tb", "a\r", "a\n", "a\x00", "a "} {
+				if err := store.Create(handle, "secret"); err != ErrInvalidHandle {
+					t.Errorf("Create(%q) returned %v, want %v", handle, err, ErrInvalidHandle)
+				}
+			}
+			// A rejected "a,b" must not have squatted "a"
+			if ok, err := store.Lookup("a"); err != nil || ok {
+				t.Errorf("Lookup(a) = %t, %v, want false", ok, err)
+			}
+			if err := store.Create("a", "secret"); err != nil {
+				t.Fatalf("Create(a) returned error: %v", err)
+			}
+			if ok, err := store.Verify("a", "secret"); err != nil || !ok {
+				t.Errorf("Verify(a) = %t, %v, want true", ok, err)
+			}
+		})
+	}
+}